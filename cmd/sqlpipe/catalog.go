@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+)
+
+// discoverTables lists the user tables in the source database, largest first
+// so the longest transfers start earliest.
+func (app *application) discoverTables(ctx context.Context, transfer data.Transfer) ([]data.Query, error) {
+	return transfer.Source.Driver().DiscoverTables(ctx, transfer.Source.Db)
+}
+
+// discoverViews lists the user views in the source database along with
+// their definitions, which are empty for encrypted views.
+func (app *application) discoverViews(ctx context.Context, transfer data.Transfer) ([]data.Query, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT S.name, V.name, M.definition
+	FROM sys.views AS V
+	INNER JOIN sys.schemas AS S ON S.schema_id = V.schema_id
+	LEFT JOIN sys.sql_modules AS M ON M.object_id = V.object_id
+	WHERE V.is_ms_shipped = 0
+	ORDER BY S.name, V.name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying views: %v", err)
+	}
+	defer rows.Close()
+
+	queries := []data.Query{}
+	for rows.Next() {
+		var schema, view string
+		var definition sql.NullString
+		err := rows.Scan(&schema, &view, &definition)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning view: %v", err)
+		}
+
+		queries = append(queries, data.Query{
+			Schema:         schema,
+			Table:          view,
+			SourceQuery:    fmt.Sprintf("select * from %v.%v", data.QuoteMssqlIdentifier(schema), data.QuoteMssqlIdentifier(view)),
+			View:           true,
+			ViewDefinition: definition.String,
+		})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over views: %v", err)
+	}
+
+	return queries, nil
+}
+
+// tableColumns returns the column names of schema.table in ordinal order.
+func (app *application) tableColumns(ctx context.Context, transfer data.Transfer, schema, table string) ([]string, error) {
+	return transfer.Source.Driver().TableColumns(ctx, transfer.Source.Db, schema, table)
+}
+
+// columnMetadata returns the defaults and identity settings of the columns
+// of schema.table, keyed by lower cased column name.
+func (app *application) columnMetadata(ctx context.Context, transfer data.Transfer, schema, table string) (map[string]data.ColumnMetadata, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT C.name, DC.definition, C.is_identity,
+		convert(varchar(40), IC.seed_value), convert(varchar(40), IC.increment_value), convert(varchar(40), IC.last_value)
+	FROM sys.columns AS C
+	LEFT JOIN sys.default_constraints AS DC ON DC.object_id = C.default_object_id
+	LEFT JOIN sys.identity_columns AS IC ON IC.object_id = C.object_id AND IC.column_id = C.column_id
+	WHERE C.object_id = OBJECT_ID(@p1)`,
+		fmt.Sprintf("%v.%v", data.QuoteMssqlIdentifier(schema), data.QuoteMssqlIdentifier(table)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying column defaults of %v.%v: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	metadata := map[string]data.ColumnMetadata{}
+	for rows.Next() {
+		var name string
+		var definition, seed, increment, lastValue sql.NullString
+		var identity bool
+		err := rows.Scan(&name, &definition, &identity, &seed, &increment, &lastValue)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning column defaults of %v.%v: %v", schema, table, err)
+		}
+		if !definition.Valid && !identity {
+			continue
+		}
+
+		metadata[strings.ToLower(name)] = data.ColumnMetadata{
+			Default:   definition.String,
+			Identity:  identity,
+			Seed:      seed.String,
+			Increment: increment.String,
+			LastValue: lastValue.String,
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over column defaults of %v.%v: %v", schema, table, err)
+	}
+
+	return metadata, nil
+}
+
+// applyTableOptions rewrites the source query of each discovered table that
+// has per-table options. Options naming a table the filter skipped are
+// ignored; options naming a table that does not exist are an error.
+func (app *application) applyTableOptions(ctx context.Context, transfer data.Transfer, queries []data.Query, skipped []data.SkippedTable) error {
+options:
+	for _, opts := range transfer.TableOptions {
+		for i, query := range queries {
+			if !opts.Matches(query.Schema, query.Table) {
+				continue
+			}
+
+			columns := query.Columns
+			if len(opts.Columns) > 0 {
+				columns = nil
+				existing, err := app.tableColumns(ctx, transfer, query.Schema, query.Table)
+				if err != nil {
+					return err
+				}
+
+				missing := []string{}
+			requested:
+				for _, want := range opts.Columns {
+					for _, have := range existing {
+						if strings.EqualFold(want, have) {
+							columns = append(columns, have)
+							continue requested
+						}
+					}
+					missing = append(missing, want)
+				}
+
+				if len(missing) > 0 {
+					return fmt.Errorf("table %v.%v has no column(s) %v", query.Schema, query.Table, strings.Join(missing, ", "))
+				}
+			}
+
+			if len(columns) > 0 && opts.Mode == data.ModeIncremental {
+				required := append([]string{opts.WatermarkColumn}, opts.KeyColumns...)
+				for _, want := range required {
+					found := false
+					for _, have := range columns {
+						found = found || strings.EqualFold(want, have)
+					}
+					if !found {
+						return fmt.Errorf("columns of %v.%v must include %v, which incremental mode needs", query.Schema, query.Table, want)
+					}
+				}
+			}
+
+			queries[i].SourceQuery = opts.SourceQuery(transfer.Source.Driver(), query, columns)
+			queries[i].Columns = columns
+			queries[i].Mode = opts.Mode
+			queries[i].WatermarkColumn = opts.WatermarkColumn
+			queries[i].KeyColumns = opts.KeyColumns
+			queries[i].CaptureInstance = opts.CaptureInstance
+			queries[i].ApplyChanges = opts.ApplyChanges
+			queries[i].Partitions = opts.Partitions
+			queries[i].PartitionBy = opts.PartitionBy
+			queries[i].PartitionColumn = opts.PartitionColumn
+			continue options
+		}
+
+		for _, s := range skipped {
+			if opts.Matches(s.Schema, s.Table) {
+				continue options
+			}
+		}
+
+		return fmt.Errorf("table options refer to %v.%v, which does not exist in the source database", opts.Schema, opts.Table)
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+// cdcStateColumn is stored in SQLPIPE_STATE in place of a watermark column
+// name, keyed on the change log table.
+const cdcStateColumn = "$CDC_LSN"
+
+// capturedColumns returns the columns captureInstance records, in order,
+// limited to only when it is not empty. Computed columns are left out: CDC
+// records them as NULL, which applying changes would copy over the values
+// the snapshot loaded.
+func (app *application) capturedColumns(ctx context.Context, transfer data.Transfer, captureInstance string, only []string) ([]string, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT CC.column_name
+	FROM cdc.captured_columns AS CC
+	INNER JOIN cdc.change_tables AS CT ON CT.object_id = CC.object_id
+	INNER JOIN sys.columns AS C ON C.object_id = CT.source_object_id AND C.column_id = CC.column_id
+	WHERE CT.capture_instance = @p1 AND C.is_computed = 0
+	ORDER BY CC.column_ordinal`,
+		captureInstance,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying captured columns of %v: %v", captureInstance, err)
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var column string
+		err := rows.Scan(&column)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning captured column of %v: %v", captureInstance, err)
+		}
+		columns = append(columns, column)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over captured columns of %v: %v", captureInstance, err)
+	}
+
+	if len(only) == 0 {
+		return columns, nil
+	}
+
+	kept := []string{}
+	for _, want := range only {
+		found := false
+		for _, have := range columns {
+			if strings.EqualFold(want, have) {
+				kept = append(kept, have)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %v is computed or not captured by %v", want, captureInstance)
+		}
+	}
+
+	return kept, nil
+}
+
+// transferCdcTable appends the changes recorded for table since the last run
+// to the <TABLE>_CHANGES log in the prod schema and, when asked, applies them
+// to the <TABLE> current-state table. The first run, and any run whose stored
+// LSN has fallen out of the capture instance's retention, starts from the
+// oldest change available and reloads the current-state table in full.
+func (app *application) transferCdcTable(
+	ctx context.Context,
+	tableLogger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	prodSchemaName string,
+	queryIndex int,
+	table data.Query,
+) error {
+	captureInstance := table.CaptureInstance
+	if captureInstance == "" {
+		captureInstance = fmt.Sprintf("%v_%v", table.Schema, table.Table)
+	}
+
+	var minLsn, maxLsn sql.NullString
+	err := scanSourceRow(
+		ctx,
+		transfer,
+		`SELECT convert(varchar(22), sys.fn_cdc_get_min_lsn(@p1), 1), convert(varchar(22), sys.fn_cdc_get_max_lsn(), 1)`,
+		[]interface{}{captureInstance},
+		&minLsn,
+		&maxLsn,
+	)
+	if err != nil {
+		return fmt.Errorf("error reading lsn range of %v: %v", captureInstance, err)
+	}
+	if !minLsn.Valid || !maxLsn.Valid || strings.Trim(strings.TrimPrefix(minLsn.String, "0x"), "0") == "" {
+		return fmt.Errorf("cdc capture instance %v does not exist or cdc is not enabled", captureInstance)
+	}
+
+	cleanedTableName, tableName := table.TargetName()
+	changesTableName := tableName + "_CHANGES"
+	cleanedChangesTableName := fmt.Sprintf(`"%v"`, changesTableName)
+
+	stored, err := app.loadState(ctx, targetDb, transfer, prodSchemaName, changesTableName, cdcStateColumn)
+	if err != nil {
+		return err
+	}
+
+	reinitialize := stored == "" || strings.ToUpper(stored) < strings.ToUpper(minLsn.String)
+	if stored != "" && reinitialize {
+		tableLogger.PrintWarn("stored lsn is older than the capture instance's minimum, reinitializing", map[string]string{
+			"phase":   "extract",
+			"lsn":     stored,
+			"min_lsn": minLsn.String,
+		})
+	}
+
+	if !reinitialize && strings.ToUpper(stored) >= strings.ToUpper(maxLsn.String) {
+		tableLogger.PrintInfo("no new changes", map[string]string{
+			"phase": "extract",
+			"lsn":   stored,
+		})
+		return nil
+	}
+
+	snapshot := false
+	if table.ApplyChanges {
+		snapshot = reinitialize
+		if !snapshot {
+			exists, err := app.prodTableExists(ctx, targetDb, transfer, prodSchemaName, tableName)
+			if err != nil {
+				return err
+			}
+			snapshot = !exists
+		}
+	}
+
+	// The snapshot is taken after the max LSN was read, so it already holds
+	// every change up to it. Changes past it are applied by the next run.
+	if snapshot {
+		tableLogger.PrintInfo("loading current-state table in full", map[string]string{"phase": "extract"})
+
+		_, err := app.stageQuery(ctx, tableLogger, transfer, targetDb, stagingSchemaName, cleanedTableName, CleanString(tableName), nil, table.SourceQuery)
+		if err != nil {
+			return err
+		}
+
+		err = app.swapIntoProd(ctx, tableLogger, transfer, targetDb, stagingSchemaName, prodSchemaName, cleanedTableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	columns, err := app.capturedColumns(ctx, transfer, captureInstance, table.Columns)
+	if err != nil {
+		return err
+	}
+
+	fromLsn := stored
+	if reinitialize {
+		fromLsn = minLsn.String
+	}
+
+	changesQuery, err := data.CdcChangesQuery(captureInstance, columns, fromLsn, maxLsn.String, !reinitialize)
+	if err != nil {
+		return err
+	}
+
+	tableLogger.PrintInfo("reading changes", map[string]string{
+		"phase":    "extract",
+		"from_lsn": fromLsn,
+		"to_lsn":   maxLsn.String,
+	})
+
+	staged, err := app.stageQuery(ctx, tableLogger, transfer, targetDb, stagingSchemaName, cleanedChangesTableName, auxiliaryS3DirName("cdc", tableName), nil, changesQuery)
+	app.recordRowCounts(transfer, queryIndex, staged)
+	if err != nil {
+		return err
+	}
+
+	tableLogger.PrintInfo("appending to change log", map[string]string{
+		"phase":        "merge",
+		"rows":         strconv.FormatInt(staged.rows, 10),
+		"target_table": changesTableName,
+	})
+
+	prodChangesTable := fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, prodSchemaName, cleanedChangesTableName)
+	stagingChangesTable := fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, stagingSchemaName, cleanedChangesTableName)
+
+	// The LSN is saved only after the changes are applied, so a run that
+	// fails in between reads the same changes again. Rows already in the log
+	// are skipped rather than appended twice.
+	for _, query := range []string{
+		fmt.Sprintf("create table if not exists %v like %v", prodChangesTable, stagingChangesTable),
+		fmt.Sprintf(
+			"insert into %v select * from %v as s where not exists (select 1 from %v as t where t.%v = s.%v and t.%v = s.%v and t.%v = s.%v)",
+			prodChangesTable,
+			stagingChangesTable,
+			prodChangesTable,
+			data.CdcLsnColumn, data.CdcLsnColumn,
+			data.CdcSeqvalColumn, data.CdcSeqvalColumn,
+			data.CdcOperationColumn, data.CdcOperationColumn,
+		),
+	} {
+		_, err = execSnowflake(ctx, targetDb, query)
+		if err != nil {
+			return fmt.Errorf("error appending to change log, query was %v, error was %v", query, err)
+		}
+	}
+
+	if table.ApplyChanges && !snapshot && staged.rows > 0 {
+		keys := table.KeyColumns
+		if len(keys) == 0 {
+			keys, err = app.primaryKeyColumns(ctx, transfer, table.Schema, table.Table)
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				return fmt.Errorf("table %v.%v has no primary key; set key_columns to apply changes", table.Schema, table.Table)
+			}
+		}
+
+		tableLogger.PrintInfo("applying changes to current-state table", map[string]string{"phase": "merge"})
+
+		applyQuery := cdcApplyQuery(
+			fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, prodSchemaName, cleanedTableName),
+			stagingChangesTable,
+			staged.columnInfo.TargetColumnNames,
+			keys,
+		)
+		_, err = execSnowflake(ctx, targetDb, applyQuery)
+		if err != nil {
+			return fmt.Errorf("error applying changes, query was %v, error was %v", applyQuery, err)
+		}
+	}
+
+	err = app.saveState(ctx, targetDb, transfer, prodSchemaName, changesTableName, table, cdcStateColumn, maxLsn.String)
+	if err != nil {
+		return err
+	}
+
+	tableLogger.PrintInfo("finished table", map[string]string{"phase": "merge"})
+
+	return nil
+}
+
+// cdcApplyQuery merges the last change to each key into the current-state
+// table, deleting rows whose last change was a delete.
+func cdcApplyQuery(prodTable, changesTable string, changeColumns, keys []string) string {
+	columns := []string{}
+	for _, column := range changeColumns {
+		switch column {
+		case data.CdcLsnColumn, data.CdcSeqvalColumn, data.CdcOperationColumn:
+		default:
+			columns = append(columns, column)
+		}
+	}
+
+	partition := make([]string, len(keys))
+	on := make([]string, len(keys))
+	isKey := map[string]bool{}
+	for i, key := range keys {
+		key = data.SnowflakeColumnName(key)
+		partition[i] = key
+		on[i] = fmt.Sprintf("t.%v = s.%v", key, key)
+		isKey[key] = true
+	}
+
+	set := []string{}
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = "s." + column
+		if !isKey[column] {
+			set = append(set, fmt.Sprintf("t.%v = s.%v", column, column))
+		}
+	}
+
+	query := fmt.Sprintf(
+		"merge into %v as t using (select * from %v qualify row_number() over (partition by %v order by %v desc, %v desc, %v desc) = 1) as s on %v",
+		prodTable,
+		changesTable,
+		strings.Join(partition, ", "),
+		data.CdcLsnColumn,
+		data.CdcSeqvalColumn,
+		data.CdcOperationColumn,
+		strings.Join(on, " and "),
+	)
+	query += fmt.Sprintf(" when matched and s.%v = %v then delete", data.CdcOperationColumn, data.CdcOperationDelete)
+	if len(set) > 0 {
+		query += " when matched then update set " + strings.Join(set, ", ")
+	}
+	query += fmt.Sprintf(
+		" when not matched and s.%v <> %v then insert (%v) values (%v)",
+		data.CdcOperationColumn,
+		data.CdcOperationDelete,
+		strings.Join(columns, ", "),
+		strings.Join(values, ", "),
+	)
+
+	return query
+}
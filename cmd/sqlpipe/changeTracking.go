@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+// changeTrackingStateColumn is stored in SQLPIPE_STATE in place of a
+// watermark column name for tables synced with change tracking.
+const changeTrackingStateColumn = "$CHANGE_TRACKING_VERSION"
+
+// prepareChangeTracking points table's source query at the rows changed since
+// the version stored by the last run. The current version is read before
+// extracting, so changes made during the run are replayed by the next one;
+// MERGE and DELETE make that harmless. Without a usable stored version the
+// table is loaded in full and the version recorded for next time.
+func (app *application) prepareChangeTracking(ctx context.Context, transfer data.Transfer, targetDb *sql.DB, prodSchemaName string, table *data.Query) (incrementalLoad, error) {
+	load := incrementalLoad{stateColumn: changeTrackingStateColumn}
+
+	source := fmt.Sprintf("%v.%v", data.QuoteMssqlIdentifier(table.Schema), data.QuoteMssqlIdentifier(table.Table))
+
+	var current, minValid sql.NullInt64
+	err := scanSourceRow(
+		ctx,
+		transfer,
+		`SELECT CHANGE_TRACKING_CURRENT_VERSION(), CHANGE_TRACKING_MIN_VALID_VERSION(OBJECT_ID(@p1))`,
+		[]interface{}{source},
+		&current,
+		&minValid,
+	)
+	if err != nil {
+		return load, fmt.Errorf("error reading change tracking versions of %v.%v: %v", table.Schema, table.Table, err)
+	}
+	if !current.Valid || !minValid.Valid {
+		return load, fmt.Errorf("change tracking is not enabled on %v.%v", table.Schema, table.Table)
+	}
+	load.state = strconv.FormatInt(current.Int64, 10)
+
+	load.keys, err = app.primaryKeyColumns(ctx, transfer, table.Schema, table.Table)
+	if err != nil {
+		return load, err
+	}
+	if len(load.keys) == 0 {
+		return load, fmt.Errorf("table %v.%v has no primary key", table.Schema, table.Table)
+	}
+
+	_, tableName := table.TargetName()
+
+	stored, err := app.loadState(ctx, targetDb, transfer, prodSchemaName, tableName, changeTrackingStateColumn)
+	if err != nil {
+		return load, err
+	}
+	if stored == "" {
+		return load, nil
+	}
+
+	lastVersion, err := strconv.ParseInt(stored, 10, 64)
+	if err != nil {
+		return load, fmt.Errorf("invalid change tracking version %q stored for %v", stored, tableName)
+	}
+	if lastVersion < minValid.Int64 {
+		return load, nil
+	}
+
+	load.merge, err = app.prodTableExists(ctx, targetDb, transfer, prodSchemaName, tableName)
+	if err != nil || !load.merge {
+		return load, err
+	}
+
+	projection := "T.*"
+	if len(table.Columns) > 0 {
+		columns := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = "T." + data.QuoteMssqlIdentifier(column)
+		}
+		projection = strings.Join(columns, ", ")
+	}
+
+	on := make([]string, len(load.keys))
+	keys := make([]string, len(load.keys))
+	for i, key := range load.keys {
+		key = data.QuoteMssqlIdentifier(key)
+		on[i] = fmt.Sprintf("T.%v = CT.%v", key, key)
+		keys[i] = "CT." + key
+	}
+
+	changes := fmt.Sprintf("CHANGETABLE(CHANGES %v, %v) AS CT", source, lastVersion)
+
+	table.SourceQuery = fmt.Sprintf(
+		"select %v from %v inner join %v AS T on %v",
+		projection,
+		changes,
+		source,
+		strings.Join(on, " and "),
+	)
+	load.deletesQuery = fmt.Sprintf(
+		"select %v from %v where CT.SYS_CHANGE_OPERATION = 'D'",
+		strings.Join(keys, ", "),
+		changes,
+	)
+
+	return load, nil
+}
+
+// applyDeletes stages the keys selected by load.deletesQuery next to the
+// table's staged rows and deletes them from the prod table.
+func (app *application) applyDeletes(
+	ctx context.Context,
+	tableLogger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	prodSchemaName string,
+	cleanedTableName string,
+	unquotedTableName string,
+	load incrementalLoad,
+) error {
+	deletesTableName := fmt.Sprintf(`"%v$DELETES"`, unquotedTableName)
+
+	deletesS3DirName := auxiliaryS3DirName("deletes", unquotedTableName)
+
+	staged, err := app.stageQuery(ctx, tableLogger, transfer, targetDb, stagingSchemaName, deletesTableName, deletesS3DirName, nil, load.deletesQuery)
+	if err != nil {
+		return err
+	}
+
+	tableLogger.PrintInfo("deleting rows from prod table", map[string]string{
+		"phase": "merge",
+		"rows":  strconv.FormatInt(staged.rows, 10),
+	})
+
+	on := make([]string, len(load.keys))
+	for i, key := range load.keys {
+		key = data.SnowflakeColumnName(key)
+		on[i] = fmt.Sprintf("t.%v = s.%v", key, key)
+	}
+
+	deleteQuery := fmt.Sprintf(
+		"delete from %v.%v.%v as t using %v.%v.%v as s where %v",
+		transfer.Target.DbName,
+		prodSchemaName,
+		cleanedTableName,
+		transfer.Target.DbName,
+		stagingSchemaName,
+		deletesTableName,
+		strings.Join(on, " and "),
+	)
+	_, err = execSnowflake(ctx, targetDb, deleteQuery)
+	if err != nil {
+		return fmt.Errorf("error deleting rows from prod table, query was %v, error was %v", deleteQuery, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+// copyDescriptions sets the MS_Description of each transferred source table
+// and of its columns as comments on the prod table. Failures are logged, not
+// returned.
+func (app *application) copyDescriptions(
+	ctx context.Context,
+	logger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	prodSchemaName string,
+) {
+	tables := map[string]data.Query{}
+	for _, query := range transfer.Queries {
+		if query.Schema == "" || (query.Mode == data.ModeCdc && !query.ApplyChanges) {
+			continue
+		}
+		tables[strings.ToLower(query.Schema+"."+query.Table)] = query
+	}
+	if len(tables) == 0 {
+		return
+	}
+
+	descriptions, err := app.sourceDescriptions(ctx, transfer)
+	if err != nil {
+		logger.PrintWarn("could not copy descriptions", map[string]string{
+			"phase": "comments",
+			"error": err.Error(),
+		})
+		return
+	}
+
+	commented, failed := 0, 0
+	for _, description := range descriptions {
+		table, ok := tables[strings.ToLower(description.Schema+"."+description.Table)]
+		if !ok || (description.Column != "" && missingColumns(table, []string{description.Column}) != "") {
+			continue
+		}
+
+		cleanedTableName, _ := table.TargetName()
+		query := description.CommentQuery(fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, prodSchemaName, cleanedTableName))
+		_, err := execSnowflake(ctx, targetDb, query)
+		if err != nil {
+			failed++
+			logger.PrintWarn("could not set comment", map[string]string{
+				"phase":  "comments",
+				"schema": description.Schema,
+				"table":  description.Table,
+				"column": description.Column,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		commented++
+	}
+
+	logger.PrintInfo("copied descriptions", map[string]string{
+		"phase":     "comments",
+		"commented": strconv.Itoa(commented),
+		"failed":    strconv.Itoa(failed),
+	})
+}
+
+// sourceDescriptions returns the MS_Description extended properties of the
+// source's user tables and views and of their columns.
+func (app *application) sourceDescriptions(ctx context.Context, transfer data.Transfer) ([]data.Description, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT S.name, O.name, C.name, convert(nvarchar(4000), EP.value)
+	FROM sys.extended_properties AS EP
+	INNER JOIN sys.objects AS O ON O.object_id = EP.major_id
+	INNER JOIN sys.schemas AS S ON S.schema_id = O.schema_id
+	LEFT JOIN sys.columns AS C ON C.object_id = EP.major_id AND C.column_id = EP.minor_id
+	WHERE EP.class = 1 AND EP.name = 'MS_Description' AND O.type IN ('U', 'V') AND O.is_ms_shipped = 0
+	AND (EP.minor_id = 0 OR C.column_id IS NOT NULL)
+	ORDER BY S.name, O.name, EP.minor_id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying descriptions: %v", err)
+	}
+	defer rows.Close()
+
+	descriptions := []data.Description{}
+	for rows.Next() {
+		var schema, table string
+		var column, text sql.NullString
+		err := rows.Scan(&schema, &table, &column, &text)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning description: %v", err)
+		}
+		if !text.Valid {
+			continue
+		}
+
+		descriptions = append(descriptions, data.Description{
+			Schema: schema,
+			Table:  table,
+			Column: column.String,
+			Text:   text.String,
+		})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over descriptions: %v", err)
+	}
+
+	return descriptions, nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+// replicateConstraints adds the primary key, unique and foreign key
+// constraints of the transferred source tables to their prod tables, once
+// every table exists. Keys go first so foreign keys can reference them.
+// Constraints the prod table already has, such as on merged tables, are left
+// alone. Failures are reported on the transfer, not returned.
+func (app *application) replicateConstraints(
+	ctx context.Context,
+	logger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	prodSchemaName string,
+) {
+	reports, err := app.addConstraints(ctx, transfer, targetDb, prodSchemaName)
+	if err != nil {
+		logger.PrintWarn("could not replicate constraints", map[string]string{
+			"phase": "constraints",
+			"error": err.Error(),
+		})
+		return
+	}
+
+	counts := map[string]int{}
+	for _, report := range reports {
+		counts[report.Status]++
+		if report.Status != data.ConstraintFailed {
+			continue
+		}
+		logger.PrintWarn("could not add constraint", map[string]string{
+			"phase":      "constraints",
+			"schema":     report.Schema,
+			"table":      report.Table,
+			"constraint": report.Constraint,
+			"reason":     report.Reason,
+		})
+	}
+
+	logger.PrintInfo("replicated constraints", map[string]string{
+		"phase":   "constraints",
+		"created": strconv.Itoa(counts[data.ConstraintCreated]),
+		"exists":  strconv.Itoa(counts[data.ConstraintExists]),
+		"skipped": strconv.Itoa(counts[data.ConstraintSkipped]),
+		"failed":  strconv.Itoa(counts[data.ConstraintFailed]),
+	})
+
+	app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+		t.Constraints = reports
+	})
+}
+
+func (app *application) addConstraints(ctx context.Context, transfer data.Transfer, targetDb *sql.DB, prodSchemaName string) ([]data.ConstraintReport, error) {
+	// Only discovered tables keep their source shape. CDC tables without
+	// applied changes only have a change log in prod.
+	tables := map[string]data.Query{}
+	for _, query := range transfer.Queries {
+		if query.Schema == "" || query.View || (query.Mode == data.ModeCdc && !query.ApplyChanges) {
+			continue
+		}
+		tables[strings.ToLower(query.Schema+"."+query.Table)] = query
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	constraints, err := app.sourceKeyConstraints(ctx, transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys, err := app.sourceForeignKeys(ctx, transfer)
+	if err != nil {
+		return nil, err
+	}
+	for _, fk := range foreignKeys {
+		constraints = append(constraints, data.Constraint{
+			Schema:     fk.FromSchema,
+			Table:      fk.FromTable,
+			Name:       fk.Name,
+			Type:       data.ConstraintForeignKey,
+			Columns:    fk.Columns,
+			RefSchema:  fk.ToSchema,
+			RefTable:   fk.ToTable,
+			RefColumns: fk.RefColumns,
+		})
+	}
+
+	existing, err := app.prodConstraints(ctx, targetDb, transfer, prodSchemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []data.ConstraintReport{}
+	for _, c := range constraints {
+		table, ok := tables[strings.ToLower(c.Schema+"."+c.Table)]
+		if !ok {
+			continue
+		}
+
+		report := data.ConstraintReport{
+			Schema:     c.Schema,
+			Table:      c.Table,
+			Constraint: c.Name,
+			Type:       c.Type,
+		}
+
+		cleanedTableName, unquotedTableName := table.TargetName()
+		if existing[unquotedTableName+"."+strings.Trim(c.TargetName(), `"`)] {
+			report.Status = data.ConstraintExists
+			reports = append(reports, report)
+			continue
+		}
+
+		refTable := ""
+		reason := missingColumns(table, c.Columns)
+		if c.Type == data.ConstraintForeignKey && reason == "" {
+			ref, ok := tables[strings.ToLower(c.RefSchema+"."+c.RefTable)]
+			if !ok {
+				reason = fmt.Sprintf("references %v.%v, which is not in the transfer", c.RefSchema, c.RefTable)
+			} else {
+				reason = missingColumns(ref, c.RefColumns)
+				cleanedRefName, _ := ref.TargetName()
+				refTable = fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, prodSchemaName, cleanedRefName)
+			}
+		}
+		if reason != "" {
+			report.Status = data.ConstraintSkipped
+			report.Reason = reason
+			reports = append(reports, report)
+			continue
+		}
+
+		report.TargetQuery = c.AddConstraintQuery(
+			fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, prodSchemaName, cleanedTableName),
+			refTable,
+		)
+		_, err := execSnowflake(ctx, targetDb, report.TargetQuery)
+		if err != nil {
+			report.Status = data.ConstraintFailed
+			report.Reason = err.Error()
+		} else {
+			report.Status = data.ConstraintCreated
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// missingColumns explains which of columns a table's column selection left
+// out, or returns "" when all were extracted.
+func missingColumns(table data.Query, columns []string) string {
+	if len(table.Columns) == 0 {
+		return ""
+	}
+
+	missing := []string{}
+columns:
+	for _, column := range columns {
+		for _, have := range table.Columns {
+			if strings.EqualFold(column, have) {
+				continue columns
+			}
+		}
+		missing = append(missing, column)
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("column(s) %v are not extracted", strings.Join(missing, ", "))
+}
+
+// prodConstraints returns the constraints in the prod schema as
+// TABLE.CONSTRAINT names.
+func (app *application) prodConstraints(ctx context.Context, db *sql.DB, transfer data.Transfer, prodSchemaName string) (map[string]bool, error) {
+	query := fmt.Sprintf(
+		`select TABLE_NAME, CONSTRAINT_NAME from %v.INFORMATION_SCHEMA.TABLE_CONSTRAINTS where TABLE_SCHEMA = %v`,
+		transfer.Target.DbName,
+		snowflakeString(prodSchemaName),
+	)
+
+	rows, err := querySnowflake(ctx, db, query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing prod constraints, query was %v. error was: %v", query, err)
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var table, constraint string
+		err := rows.Scan(&table, &constraint)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning prod constraint: %v", err)
+		}
+		existing[table+"."+constraint] = true
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over prod constraints: %v", err)
+	}
+
+	return existing, nil
+}
+
+// sourceKeyConstraints returns the primary key and unique constraints of
+// every source table, primary keys first.
+func (app *application) sourceKeyConstraints(ctx context.Context, transfer data.Transfer) ([]data.Constraint, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT S.name, T.name, KC.name, KC.type, C.name
+	FROM sys.key_constraints AS KC
+	INNER JOIN sys.tables AS T ON T.object_id = KC.parent_object_id
+	INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id
+	INNER JOIN sys.index_columns AS IC ON IC.object_id = KC.parent_object_id AND IC.index_id = KC.unique_index_id AND IC.key_ordinal > 0
+	INNER JOIN sys.columns AS C ON C.object_id = IC.object_id AND C.column_id = IC.column_id
+	ORDER BY KC.type, S.name, T.name, KC.name, IC.key_ordinal`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying key constraints: %v", err)
+	}
+	defer rows.Close()
+
+	constraints := []data.Constraint{}
+	for rows.Next() {
+		var schema, table, name, kind, column string
+		err := rows.Scan(&schema, &table, &name, &kind, &column)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning key constraint: %v", err)
+		}
+
+		last := len(constraints) - 1
+		if last < 0 || constraints[last].Schema != schema || constraints[last].Table != table || constraints[last].Name != name {
+			constraintType := data.ConstraintUnique
+			if kind == "PK" {
+				constraintType = data.ConstraintPrimaryKey
+			}
+			constraints = append(constraints, data.Constraint{Schema: schema, Table: table, Name: name, Type: constraintType})
+			last++
+		}
+		constraints[last].Columns = append(constraints[last].Columns, column)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over key constraints: %v", err)
+	}
+
+	return constraints, nil
+}
+
+// sourceForeignKeys returns every foreign key between source tables.
+func (app *application) sourceForeignKeys(ctx context.Context, transfer data.Transfer) ([]data.ForeignKey, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT FS.name, FK.name, PS.name, PT.name, PC.name, RS.name, RT.name, RC.name
+	FROM sys.foreign_keys AS FK
+	INNER JOIN sys.schemas AS FS ON FS.schema_id = FK.schema_id
+	INNER JOIN sys.foreign_key_columns AS FKC ON FKC.constraint_object_id = FK.object_id
+	INNER JOIN sys.tables AS PT ON PT.object_id = FK.parent_object_id
+	INNER JOIN sys.schemas AS PS ON PS.schema_id = PT.schema_id
+	INNER JOIN sys.columns AS PC ON PC.object_id = FKC.parent_object_id AND PC.column_id = FKC.parent_column_id
+	INNER JOIN sys.tables AS RT ON RT.object_id = FK.referenced_object_id
+	INNER JOIN sys.schemas AS RS ON RS.schema_id = RT.schema_id
+	INNER JOIN sys.columns AS RC ON RC.object_id = FKC.referenced_object_id AND RC.column_id = FKC.referenced_column_id
+	ORDER BY FS.name, FK.name, FKC.constraint_column_id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying foreign keys: %v", err)
+	}
+	defer rows.Close()
+
+	foreignKeys := []data.ForeignKey{}
+	for rows.Next() {
+		var schema, name, fromSchema, fromTable, column, toSchema, toTable, refColumn string
+		err := rows.Scan(&schema, &name, &fromSchema, &fromTable, &column, &toSchema, &toTable, &refColumn)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning foreign key: %v", err)
+		}
+
+		last := len(foreignKeys) - 1
+		if last < 0 || foreignKeys[last].Schema != schema || foreignKeys[last].Name != name {
+			foreignKeys = append(foreignKeys, data.ForeignKey{
+				Schema:     schema,
+				Name:       name,
+				FromSchema: fromSchema,
+				FromTable:  fromTable,
+				ToSchema:   toSchema,
+				ToTable:    toTable,
+			})
+			last++
+		}
+		foreignKeys[last].Columns = append(foreignKeys[last].Columns, column)
+		foreignKeys[last].RefColumns = append(foreignKeys[last].RefColumns, refColumn)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over foreign keys: %v", err)
+	}
+
+	return foreignKeys, nil
+}
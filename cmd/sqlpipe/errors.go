@@ -1,23 +1,13 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"runtime/debug"
-	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-
-	app.putLogEvents(err.Error())
-
 	app.logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
@@ -38,41 +28,34 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusNotFound, message)
 }
 
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.putLogEvents(err.Error())
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.putLogEvents(fmt.Sprintf("%+v", errors))
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
@@ -80,45 +63,20 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	w.Header().Set("WWW-Authenticate", "Bearer")
 
 	message := "invalid or missing authentication token"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account must be activated to access this resource"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
-	app.putLogEvents(message)
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
-
-func (app *application) putLogEvents(message string) {
-	ctx := context.Background()
-
-	timestamp := aws.Int64(time.Now().UnixNano() / int64(time.Millisecond))
-	input := &cloudwatchlogs.PutLogEventsInput{
-		LogGroupName:  aws.String(app.config.cloudWatch.logGroupName),
-		LogStreamName: aws.String(app.config.cloudWatch.logStreamName),
-		LogEvents: []types.InputLogEvent{
-			{
-				Message:   aws.String(message),
-				Timestamp: timestamp,
-			},
-		},
-	}
-
-	_, err := app.cloudWatchClient.PutLogEvents(ctx, input)
-	if err != nil {
-		log.Printf("PutLogEvents error: %v", err)
-	}
-}
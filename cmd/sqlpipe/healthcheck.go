@@ -1,7 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
 )
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -17,3 +28,162 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.errorResponse(w, r, http.StatusInternalServerError, err)
 	}
 }
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// checkDependency runs check with the configured timeout and reports how it
+// went. A nil check means the dependency is not configured and is skipped.
+func (app *application) checkDependency(ctx context.Context, check func(ctx context.Context) error) dependencyStatus {
+	if check == nil {
+		return dependencyStatus{Status: "skipped"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, app.config.healthcheck.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	status := dependencyStatus{
+		Status:    "ok",
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		status.Status = "failed"
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// readinessHandler checks the dependencies a transfer needs. A POST body may
+// name one of the server's Snowflake profiles, which is then logged in to as
+// well.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	var target *data.Target
+
+	if r.Method == http.MethodPost {
+		var input struct {
+			SnowflakeProfile string `json:"snowflake_profile"`
+		}
+
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.SnowflakeProfile != "" {
+			profile, ok := app.snowflakeProfiles[input.SnowflakeProfile]
+			if !ok {
+				v := validator.New()
+				v.AddError("snowflake_profile", "must name a profile configured with -healthcheck-snowflake-profiles")
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+			target = &profile
+		}
+	}
+
+	var s3Check, cloudWatchCheck, snowflakeCheck func(ctx context.Context) error
+
+	if app.config.healthcheck.s3Bucket != "" {
+		s3Check = func(ctx context.Context) error {
+			s3Client, _, err := app.s3Clients()
+			if err != nil {
+				return err
+			}
+
+			_, err = s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+				Bucket: aws.String(app.config.healthcheck.s3Bucket),
+			})
+			return err
+		}
+	}
+
+	if app.logShipper != nil {
+		cloudWatchCheck = func(ctx context.Context) error {
+			_, err := app.cloudWatchClient.DescribeLogStreams(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+				LogGroupName:        aws.String(app.config.cloudWatch.logGroupName),
+				LogStreamNamePrefix: aws.String(app.config.cloudWatch.logStreamName),
+			})
+			if err != nil {
+				return err
+			}
+			return app.logShipper.LastError()
+		}
+	}
+
+	if target != nil {
+		snowflakeCheck = func(ctx context.Context) error {
+			privKey, err := data.ReadPrivateKey(target.PrivateKeyLocation)
+			if err != nil {
+				return err
+			}
+			target.PrivateKey = *privKey
+
+			db, err := target.Open("")
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			return db.PingContext(ctx)
+		}
+	}
+
+	checks := map[string]dependencyStatus{
+		"transfer_store": app.checkDependency(r.Context(), app.transfers.Ping),
+		"s3":             app.checkDependency(r.Context(), s3Check),
+		"cloudwatch":     app.checkDependency(r.Context(), cloudWatchCheck),
+		"snowflake":      app.checkDependency(r.Context(), snowflakeCheck),
+	}
+
+	status := "ready"
+	httpStatus := http.StatusOK
+	for _, check := range checks {
+		if check.Status == "failed" {
+			status = "not_ready"
+			httpStatus = http.StatusServiceUnavailable
+		}
+	}
+
+	err := app.writeJSON(w, httpStatus, envelope{"status": status, "checks": checks}, nil)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err)
+	}
+}
+
+// loadSnowflakeProfiles reads the Snowflake logins the readiness check may
+// be asked to try: a JSON object keyed by profile name, each profile holding
+// the target_* login fields of a transfer. Requests only ever pick a profile
+// by name, so an unauthenticated caller never chooses a key file.
+func loadSnowflakeProfiles(path string) (map[string]data.Target, error) {
+	profiles := map[string]data.Target{}
+	if path == "" {
+		return profiles, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snowflake profiles: %v", err)
+	}
+
+	err = json.Unmarshal(contents, &profiles)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse snowflake profiles: %v", err)
+	}
+
+	for name, profile := range profiles {
+		v := validator.New()
+		data.ValidateTargetConnection(v, profile)
+		for field, message := range v.Errors {
+			return nil, fmt.Errorf("snowflake profile %v: %v %v", name, field, message)
+		}
+	}
+
+	return profiles, nil
+}
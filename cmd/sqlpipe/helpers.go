@@ -143,7 +143,7 @@ func (app *application) background(fn func()) {
 		defer app.wg.Done()
 		defer func() {
 			if err := recover(); err != nil {
-				app.putLogEvents(fmt.Sprintf("handled panic: %v", err))
+				app.logger.PrintError(fmt.Errorf("handled panic: %v", err), nil)
 			}
 		}()
 		fn()
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+)
+
+// incrementalLoad is what an incremental or change tracking table needs
+// between extraction and the final swap. state is saved under stateColumn
+// once the table is loaded; deletesQuery, when set, selects the keys of rows
+// to delete from the prod table.
+type incrementalLoad struct {
+	stateColumn  string
+	state        string
+	keys         []string
+	merge        bool
+	deletesQuery string
+}
+
+func stateTableName(transfer data.Transfer) string {
+	return fmt.Sprintf("%v.PUBLIC.SQLPIPE_STATE", transfer.Target.DbName)
+}
+
+func snowflakeString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (app *application) createStateTable(ctx context.Context, db *sql.DB, transfer data.Transfer) error {
+	query := fmt.Sprintf(
+		`create table if not exists %v (
+			TARGET_SCHEMA VARCHAR,
+			TARGET_TABLE VARCHAR,
+			SOURCE_SCHEMA VARCHAR,
+			SOURCE_TABLE VARCHAR,
+			WATERMARK_COLUMN VARCHAR,
+			WATERMARK VARCHAR,
+			UPDATED_AT TIMESTAMP_LTZ
+		)`,
+		stateTableName(transfer),
+	)
+	_, err := execSnowflake(ctx, db, query)
+	if err != nil {
+		return fmt.Errorf("error creating state table, query was %v. error was: %v", query, err)
+	}
+	return nil
+}
+
+// loadState returns the watermark stored for a prod table by the last
+// successful run, or "" when there is none.
+func (app *application) loadState(ctx context.Context, db *sql.DB, transfer data.Transfer, prodSchemaName, tableName, column string) (string, error) {
+	query := fmt.Sprintf(
+		`select WATERMARK from %v where TARGET_SCHEMA = %v and TARGET_TABLE = %v and WATERMARK_COLUMN = %v`,
+		stateTableName(transfer),
+		snowflakeString(prodSchemaName),
+		snowflakeString(tableName),
+		snowflakeString(column),
+	)
+
+	var watermark sql.NullString
+	err := queryRowSnowflake(ctx, db, query, &watermark)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading state, query was %v. error was: %v", query, err)
+	}
+
+	return watermark.String, nil
+}
+
+func (app *application) saveState(ctx context.Context, db *sql.DB, transfer data.Transfer, prodSchemaName, tableName string, table data.Query, column, value string) error {
+	query := fmt.Sprintf(
+		`merge into %v as s
+		using (select %v as TARGET_SCHEMA, %v as TARGET_TABLE) as v
+		on s.TARGET_SCHEMA = v.TARGET_SCHEMA and s.TARGET_TABLE = v.TARGET_TABLE
+		when matched then update set
+			SOURCE_SCHEMA = %v, SOURCE_TABLE = %v, WATERMARK_COLUMN = %v, WATERMARK = %v, UPDATED_AT = current_timestamp()
+		when not matched then insert
+			(TARGET_SCHEMA, TARGET_TABLE, SOURCE_SCHEMA, SOURCE_TABLE, WATERMARK_COLUMN, WATERMARK, UPDATED_AT)
+			values (v.TARGET_SCHEMA, v.TARGET_TABLE, %v, %v, %v, %v, current_timestamp())`,
+		stateTableName(transfer),
+		snowflakeString(prodSchemaName),
+		snowflakeString(tableName),
+		snowflakeString(table.Schema),
+		snowflakeString(table.Table),
+		snowflakeString(column),
+		snowflakeString(value),
+		snowflakeString(table.Schema),
+		snowflakeString(table.Table),
+		snowflakeString(column),
+		snowflakeString(value),
+	)
+	_, err := execSnowflake(ctx, db, query)
+	if err != nil {
+		return fmt.Errorf("error saving state, query was %v. error was: %v", query, err)
+	}
+	return nil
+}
+
+func (app *application) prodTableExists(ctx context.Context, db *sql.DB, transfer data.Transfer, prodSchemaName, tableName string) (bool, error) {
+	query := fmt.Sprintf(
+		`select count(*) from %v.INFORMATION_SCHEMA.TABLES where TABLE_SCHEMA = %v and TABLE_NAME = %v`,
+		transfer.Target.DbName,
+		snowflakeString(prodSchemaName),
+		snowflakeString(tableName),
+	)
+
+	var count int
+	err := queryRowSnowflake(ctx, db, query, &count)
+	if err != nil {
+		return false, fmt.Errorf("error checking for prod table, query was %v. error was: %v", query, err)
+	}
+
+	return count > 0, nil
+}
+
+// primaryKeyColumns returns the primary key of schema.table in key order.
+func (app *application) primaryKeyColumns(ctx context.Context, transfer data.Transfer, schema, table string) ([]string, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT C.name
+	FROM sys.key_constraints AS KC
+	INNER JOIN sys.index_columns AS IC ON IC.object_id = KC.parent_object_id AND IC.index_id = KC.unique_index_id
+	INNER JOIN sys.columns AS C ON C.object_id = IC.object_id AND C.column_id = IC.column_id
+	INNER JOIN sys.tables AS T ON T.object_id = KC.parent_object_id
+	INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id
+	WHERE KC.type = 'PK' AND S.name = @p1 AND T.name = @p2
+	ORDER BY IC.key_ordinal`,
+		schema,
+		table,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying primary key of %v.%v: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var column string
+		err := rows.Scan(&column)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning primary key of %v.%v: %v", schema, table, err)
+		}
+		columns = append(columns, column)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over primary key of %v.%v: %v", schema, table, err)
+	}
+
+	return columns, nil
+}
+
+func (app *application) watermarkFor(ctx context.Context, transfer data.Transfer, table data.Query) (data.Watermark, error) {
+	var sqlType string
+	var scale int
+
+	err := transfer.Source.Db.QueryRowContext(
+		ctx,
+		`SELECT type_name(C.system_type_id), C.scale
+	FROM sys.columns AS C
+	INNER JOIN sys.tables AS T ON T.object_id = C.object_id
+	INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id
+	WHERE S.name = @p1 AND T.name = @p2 AND C.name = @p3`,
+		table.Schema,
+		table.Table,
+		table.WatermarkColumn,
+	).Scan(&sqlType, &scale)
+	if errors.Is(err, sql.ErrNoRows) {
+		return data.Watermark{}, fmt.Errorf("table %v.%v has no column %v", table.Schema, table.Table, table.WatermarkColumn)
+	}
+	if err != nil {
+		return data.Watermark{}, fmt.Errorf("error looking up watermark column of %v.%v: %v", table.Schema, table.Table, err)
+	}
+
+	return data.NewWatermark(table.WatermarkColumn, sqlType, scale)
+}
+
+// prepareIncremental bounds table's source query by the stored watermark and
+// the watermark's current upper bound. Taking the bound before extracting
+// means rows written during the run are picked up by the next one. Without stored
+// state, or without a prod table to merge into, the table is loaded in full
+// and swapped in as usual.
+func (app *application) prepareIncremental(ctx context.Context, transfer data.Transfer, targetDb *sql.DB, prodSchemaName string, table *data.Query) (incrementalLoad, error) {
+	var load incrementalLoad
+
+	watermark, err := app.watermarkFor(ctx, transfer, *table)
+	if err != nil {
+		return load, err
+	}
+	load.stateColumn = table.WatermarkColumn
+
+	load.keys = table.KeyColumns
+	if len(load.keys) == 0 {
+		load.keys, err = app.primaryKeyColumns(ctx, transfer, table.Schema, table.Table)
+		if err != nil {
+			return load, err
+		}
+		if len(load.keys) == 0 {
+			return load, fmt.Errorf("table %v.%v has no primary key; set key_columns to use incremental mode", table.Schema, table.Table)
+		}
+	}
+
+	_, tableName := table.TargetName()
+
+	low, err := app.loadState(ctx, targetDb, transfer, prodSchemaName, tableName, table.WatermarkColumn)
+	if err != nil {
+		return load, err
+	}
+
+	if low != "" {
+		load.merge, err = app.prodTableExists(ctx, targetDb, transfer, prodSchemaName, tableName)
+		if err != nil {
+			return load, err
+		}
+	}
+	if !load.merge {
+		low = ""
+	}
+
+	var high sql.NullString
+	highQuery := watermark.UpperBoundQuery(data.MssqlTableReference(*table, ""))
+	err = scanSourceRow(ctx, transfer, highQuery, nil, &high)
+	if err != nil {
+		return load, fmt.Errorf("error reading watermark of %v.%v, query was %v. error was: %v", table.Schema, table.Table, highQuery, err)
+	}
+	load.state = high.String
+
+	predicate, err := watermark.Predicate(low, load.state)
+	if err != nil {
+		return load, err
+	}
+	if predicate != "" {
+		table.SourceQuery = fmt.Sprintf("select * from (%v) as sqlpipe_source where %v", table.SourceQuery, predicate)
+	}
+
+	return load, nil
+}
+
+// mergeQuery upserts the staged rows into the prod table on keys.
+func mergeQuery(prodTable, stagingTable string, columns, keys []string) string {
+	on := make([]string, len(keys))
+	for i, key := range keys {
+		key = data.SnowflakeColumnName(key)
+		on[i] = fmt.Sprintf("t.%v = s.%v", key, key)
+	}
+
+	isKey := map[string]bool{}
+	for _, key := range keys {
+		isKey[data.SnowflakeColumnName(key)] = true
+	}
+
+	set := []string{}
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = "s." + column
+		if !isKey[column] {
+			set = append(set, fmt.Sprintf("t.%v = s.%v", column, column))
+		}
+	}
+
+	query := fmt.Sprintf(
+		"merge into %v as t using %v as s on %v",
+		prodTable,
+		stagingTable,
+		strings.Join(on, " and "),
+	)
+	if len(set) > 0 {
+		query += " when matched then update set " + strings.Join(set, ", ")
+	}
+	query += fmt.Sprintf(
+		" when not matched then insert (%v) values (%v)",
+		strings.Join(columns, ", "),
+		strings.Join(values, ", "),
+	)
+
+	return query
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/sqlpipe/mssqltosnowflake/internal/logsink"
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
+)
+
+var logSinkNames = []string{"stdout", "file", "syslog", "cloudwatch"}
+
+// openLogSinks builds the writer behind app.logger from the sinks named in
+// cfg.logSinks. Only the cloudwatch sink talks to AWS, so a server started
+// without it never needs credentials. A cloudwatch sink that cannot be set up
+// is left out rather than stopping the server, and the reason is returned as
+// a warning for the caller to log; stdout stands in if no other sink is left.
+func (app *application) openLogSinks(cfg cfg) (output io.Writer, warning error, err error) {
+	sinks := map[string]bool{}
+	for _, name := range strings.Split(cfg.logSinks, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		if !validator.PermittedValue(name, logSinkNames...) {
+			return nil, nil, fmt.Errorf("unknown log sink %q, must be one of %v", name, strings.Join(logSinkNames, ", "))
+		}
+		sinks[name] = true
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil, errors.New("at least one log sink must be configured")
+	}
+
+	writers := []io.Writer{}
+
+	if sinks["stdout"] {
+		writers = append(writers, os.Stdout)
+	}
+
+	if sinks["file"] {
+		file, err := logsink.NewRotatingFile(cfg.logFile.path, cfg.logFile.maxMB*1024*1024, cfg.logFile.maxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		app.logClosers = append(app.logClosers, file)
+		writers = append(writers, file)
+	}
+
+	if sinks["syslog"] {
+		sl, err := logsink.NewSyslog(cfg.syslog.network, cfg.syslog.addr, cfg.syslog.tag)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error connecting to syslog: %v", err)
+		}
+		app.logClosers = append(app.logClosers, sl)
+		writers = append(writers, sl)
+	}
+
+	if sinks["cloudwatch"] {
+		warning = app.openCloudWatch(cfg)
+	}
+
+	if sinks["cloudwatch"] && warning == nil {
+		// Anything CloudWatch refuses is already on stdout when that sink is
+		// enabled, so only fall back to it when it is not.
+		var fallback io.Writer
+		if !sinks["stdout"] {
+			fallback = os.Stdout
+		}
+
+		app.logShipper = logsink.NewCloudWatch(
+			app.cloudWatchClient,
+			cfg.cloudWatch.logGroupName,
+			cfg.cloudWatch.logStreamName,
+			logsink.CloudWatchOptions{
+				BufferSize:    cfg.cloudWatch.bufferSize,
+				FlushInterval: cfg.cloudWatch.flushInterval,
+				Fallback:      fallback,
+			},
+		)
+		app.logClosers = append(app.logClosers, app.logShipper)
+		writers = append(writers, app.logShipper)
+
+		expvar.Publish("cloudwatch_dropped_events", expvar.Func(func() interface{} {
+			return app.logShipper.Dropped()
+		}))
+
+		expvar.Publish("cloudwatch_failed_events", expvar.Func(func() interface{} {
+			return app.logShipper.Failed()
+		}))
+	}
+
+	if len(writers) == 0 {
+		writers = append(writers, os.Stdout)
+	}
+
+	return logsink.Multi(writers...), warning, nil
+}
+
+func (app *application) openCloudWatch(cfg cfg) error {
+	if cfg.cloudWatch.logStreamName == "" {
+		return errors.New("no -cloudwatch-log-stream given and the local IP address could not be determined")
+	}
+
+	awsCfg, err := loadAwsConfig(cfg.cloudWatch.region)
+	if err != nil {
+		return err
+	}
+
+	app.cloudWatchClient = cloudwatchlogs.NewFromConfig(awsCfg)
+
+	_, err = app.cloudWatchClient.CreateLogGroup(context.Background(), &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String(cfg.cloudWatch.logGroupName),
+	})
+	if err != nil {
+		var resourceAlreadyExistsException *types.ResourceAlreadyExistsException
+		if !errors.As(err, &resourceAlreadyExistsException) {
+			return fmt.Errorf("CreateLogGroup error: %v", err)
+		}
+	}
+
+	_, err = app.cloudWatchClient.CreateLogStream(context.Background(), &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(cfg.cloudWatch.logGroupName),
+		LogStreamName: aws.String(cfg.cloudWatch.logStreamName),
+	})
+	if err != nil {
+		var resourceAlreadyExistsException *types.ResourceAlreadyExistsException
+		if !errors.As(err, &resourceAlreadyExistsException) {
+			return fmt.Errorf("CreateLogStream error: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (app *application) closeLogSinks() error {
+	var firstErr error
+	for _, closer := range app.logClosers {
+		err := closer.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
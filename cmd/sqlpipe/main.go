@@ -2,13 +2,14 @@ package main
 
 import (
 	"context"
-	"errors"
 	"expvar"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
@@ -16,11 +17,12 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/sqlpipe/mssqltosnowflake/internal/data"
 	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+	"github.com/sqlpipe/mssqltosnowflake/internal/logsink"
 	"github.com/sqlpipe/mssqltosnowflake/internal/vcs"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	_ "github.com/lib/pq"
 )
@@ -30,26 +32,83 @@ var (
 )
 
 type cfg struct {
-	port       int
+	port        int
+	healthcheck struct {
+		s3Bucket          string
+		snowflakeProfiles string
+		timeout           time.Duration
+	}
+	logLevel         string
+	logSinks         string
+	transferLogLines int
+	transferDir      string
+	logFile          struct {
+		path       string
+		maxMB      int64
+		maxBackups int
+	}
+	syslog struct {
+		network string
+		addr    string
+		tag     string
+	}
 	cloudWatch struct {
+		region        string
 		logGroupName  string
 		logStreamName string
+		bufferSize    int
+		flushInterval time.Duration
+	}
+	otel struct {
+		endpoint    string
+		insecure    bool
+		sampleRatio float64
 	}
 }
 
 type application struct {
-	config           cfg
-	transferMap      map[string]data.Transfer
-	logger           *jsonlog.Logger
-	wg               sync.WaitGroup
-	uploader         *manager.Uploader
-	cloudWatchClient *cloudwatchlogs.Client
+	config            cfg
+	transfers         *data.TransferModel
+	logger            *jsonlog.Logger
+	logClosers        []io.Closer
+	wg                sync.WaitGroup
+	s3Mu              sync.Mutex
+	s3Client          *s3.Client
+	uploader          *manager.Uploader
+	cloudWatchClient  *cloudwatchlogs.Client
+	logShipper        *logsink.CloudWatch
+	snowflakeProfiles map[string]data.Target
+	tracerProvider    *sdktrace.TracerProvider
 }
 
 func main() {
 	var cfg cfg
 
 	flag.IntVar(&cfg.port, "port", 9000, "API server port")
+	flag.StringVar(&cfg.healthcheck.s3Bucket, "healthcheck-s3-bucket", "", "S3 bucket the readiness check must be able to reach (skipped when empty)")
+	flag.StringVar(&cfg.healthcheck.snowflakeProfiles, "healthcheck-snowflake-profiles", "", "JSON file of named Snowflake logins the readiness check can be asked to try")
+	flag.DurationVar(&cfg.healthcheck.timeout, "healthcheck-timeout", 5*time.Second, "Timeout for each readiness dependency check")
+
+	flag.StringVar(&cfg.logLevel, "log-level", "info", "Minimum log level (debug|info|warn|error|fatal|off)")
+	flag.IntVar(&cfg.transferLogLines, "transfer-log-lines", 5000, "Log entries kept per transfer for GET /v1/transfers/:id/logs")
+	flag.StringVar(&cfg.transferDir, "transfer-dir", "sqlpipe-transfers", "Directory transfer records and their logs are saved to (empty to keep them in memory only)")
+	flag.StringVar(&cfg.logSinks, "log-sinks", "stdout", "Comma separated log sinks (stdout|file|syslog|cloudwatch)")
+	flag.StringVar(&cfg.logFile.path, "log-file", "sqlpipe.log", "Path of the log file used by the file sink")
+	flag.Int64Var(&cfg.logFile.maxMB, "log-file-max-mb", 100, "Size in megabytes at which the log file is rotated")
+	flag.IntVar(&cfg.logFile.maxBackups, "log-file-max-backups", 5, "Number of rotated log files to keep")
+	flag.StringVar(&cfg.syslog.network, "syslog-network", "", "Network of the syslog daemon (empty for the local daemon)")
+	flag.StringVar(&cfg.syslog.addr, "syslog-addr", "", "Address of the syslog daemon (empty for the local daemon)")
+	flag.StringVar(&cfg.syslog.tag, "syslog-tag", "sqlpipe", "Tag attached to syslog messages")
+	flag.StringVar(&cfg.cloudWatch.region, "cloudwatch-region", "us-west-2", "AWS region of the CloudWatch log group")
+	flag.StringVar(&cfg.cloudWatch.logGroupName, "cloudwatch-log-group", "sqlpipe-logs", "CloudWatch log group")
+	flag.StringVar(&cfg.cloudWatch.logStreamName, "cloudwatch-log-stream", "", "CloudWatch log stream (defaults to the local IP address)")
+	flag.IntVar(&cfg.cloudWatch.bufferSize, "cloudwatch-buffer", 10000, "Log events queued for CloudWatch before new events are dropped")
+	flag.DurationVar(&cfg.cloudWatch.flushInterval, "cloudwatch-flush-interval", 5*time.Second, "Longest time a log event waits before being sent to CloudWatch")
+
+	flag.StringVar(&cfg.otel.endpoint, "otel-endpoint", "", "OTLP/HTTP trace collector host:port (tracing is disabled when empty)")
+	flag.BoolVar(&cfg.otel.insecure, "otel-insecure", false, "Export traces over plain HTTP instead of HTTPS")
+	flag.Float64Var(&cfg.otel.sampleRatio, "otel-sample-ratio", 1.0, "Fraction of new traces to sample (0.0 - 1.0)")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -58,23 +117,20 @@ func main() {
 		fmt.Printf("Version:\t%s\n", version)
 		os.Exit(0)
 	}
-	awsCfg, err := config.LoadDefaultConfig(
-		context.Background(),
-		config.WithRegion("us-west-2"),
-	)
-	if err != nil {
-		log.Fatalf("Could not load aws default config <- %v", err)
-	}
 
 	ip, err := getLocalIPAddress()
 	if err != nil {
-		log.Fatalf("Error getting local IP address: %v", err)
+		ip = ""
 	}
 
-	cfg.cloudWatch.logGroupName = "sqlpipe-logs"
-	cfg.cloudWatch.logStreamName = ip
+	if cfg.cloudWatch.logStreamName == "" {
+		cfg.cloudWatch.logStreamName = ip
+	}
 
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	logLevel, err := jsonlog.ParseLevel(cfg.logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
+	}
 
 	expvar.NewString("version").Set(version)
 
@@ -86,43 +142,86 @@ func main() {
 		return time.Now().Unix()
 	}))
 
-	app := &application{
-		config:           cfg,
-		logger:           logger,
-		transferMap:      make(map[string]data.Transfer),
-		cloudWatchClient: cloudwatchlogs.NewFromConfig(awsCfg),
+	snowflakeProfiles, err := loadSnowflakeProfiles(cfg.healthcheck.snowflakeProfiles)
+	if err != nil {
+		log.Fatalf("Error loading -healthcheck-snowflake-profiles: %v", err)
 	}
 
-	s3Client := s3.NewFromConfig(awsCfg)
-	app.uploader = manager.NewUploader(s3Client)
+	tracerProvider, err := setupTracing(cfg)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
 
-	_, err = app.cloudWatchClient.CreateLogGroup(context.Background(), &cloudwatchlogs.CreateLogGroupInput{
-		LogGroupName: aws.String(cfg.cloudWatch.logGroupName),
-	})
+	app := &application{
+		config:            cfg,
+		transfers:         data.NewTransferModel(cfg.transferDir),
+		tracerProvider:    tracerProvider,
+		snowflakeProfiles: snowflakeProfiles,
+	}
 
+	logOutput, logWarning, err := app.openLogSinks(cfg)
 	if err != nil {
-		var resourceAlreadyExistsException *types.ResourceAlreadyExistsException
-		if !errors.As(err, &resourceAlreadyExistsException) {
-			log.Fatalf("CreateLogGroup error: %v", err)
-		}
+		log.Fatalf("Error opening log sinks: %v", err)
 	}
 
-	_, err = app.cloudWatchClient.CreateLogStream(context.Background(), &cloudwatchlogs.CreateLogStreamInput{
-		LogGroupName:  aws.String(cfg.cloudWatch.logGroupName),
-		LogStreamName: aws.String(cfg.cloudWatch.logStreamName),
-	})
+	app.logger = jsonlog.New(logOutput, logLevel)
 
+	if logWarning != nil {
+		app.logger.PrintWarn("cloudwatch log sink disabled", map[string]string{
+			"error": logWarning.Error(),
+		})
+	}
+
+	loaded, err := app.transfers.Load(cfg.transferLogLines)
 	if err != nil {
-		var resourceAlreadyExistsException *types.ResourceAlreadyExistsException
-		if !errors.As(err, &resourceAlreadyExistsException) {
-			log.Fatalf("CreateLogStream error: %v", err)
-		}
+		app.logger.PrintError(err, nil)
+		app.closeLogSinks()
+		os.Exit(1)
 	}
 
-	app.putLogEvents(fmt.Sprintf("Starting sqlpipe at IP %v", ip))
+	app.logger.PrintInfo("starting sqlpipe", map[string]string{
+		"ip":        ip,
+		"version":   version,
+		"log_sinks": cfg.logSinks,
+		"transfers": strconv.Itoa(loaded),
+	})
 
 	err = app.serve()
 	if err != nil {
-		logger.PrintFatal(err, nil)
+		app.logger.PrintError(err, nil)
+		app.closeLogSinks()
+		os.Exit(1)
+	}
+}
+
+func loadAwsConfig(region string) (aws.Config, error) {
+	awsCfg, err := config.LoadDefaultConfig(
+		context.Background(),
+		config.WithRegion(region),
+	)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("could not load aws default config <- %v", err)
+	}
+
+	return awsCfg, nil
+}
+
+// s3Clients returns the S3 client and uploader, loading the AWS config the
+// first time a transfer or check needs S3, so the server starts without AWS
+// credentials. A failed load is retried on the next call.
+func (app *application) s3Clients() (*s3.Client, *manager.Uploader, error) {
+	app.s3Mu.Lock()
+	defer app.s3Mu.Unlock()
+
+	if app.s3Client == nil {
+		awsCfg, err := loadAwsConfig("us-west-2")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		app.s3Client = s3.NewFromConfig(awsCfg)
+		app.uploader = manager.NewUploader(app.s3Client)
 	}
+
+	return app.s3Client, app.uploader, nil
 }
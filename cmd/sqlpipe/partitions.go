@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+)
+
+// splitSourceQuery returns the queries table is extracted with: its source
+// query as is, or one query per key range or native partition. Tables split
+// only because of their size are read whole when they have no integer key.
+func (app *application) splitSourceQuery(ctx context.Context, transfer data.Transfer, table data.Query) ([]string, error) {
+	source := fmt.Sprintf("%v.%v", data.QuoteMssqlIdentifier(table.Schema), data.QuoteMssqlIdentifier(table.Table))
+
+	switch {
+	case table.PartitionBy == data.PartitionByNative:
+		var function, column string
+		var fanout int
+
+		err := transfer.Source.Db.QueryRowContext(
+			ctx,
+			`SELECT PF.name, C.name, PF.fanout
+	FROM sys.indexes AS I
+	INNER JOIN sys.partition_schemes AS PS ON PS.data_space_id = I.data_space_id
+	INNER JOIN sys.partition_functions AS PF ON PF.function_id = PS.function_id
+	INNER JOIN sys.index_columns AS IC ON IC.object_id = I.object_id AND IC.index_id = I.index_id AND IC.partition_ordinal = 1
+	INNER JOIN sys.columns AS C ON C.object_id = IC.object_id AND C.column_id = IC.column_id
+	WHERE I.object_id = OBJECT_ID(@p1) AND I.index_id IN (0, 1)`,
+			source,
+		).Scan(&function, &column, &fanout)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("table %v.%v is not partitioned", table.Schema, table.Table)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error looking up partition function of %v.%v: %v", table.Schema, table.Table, err)
+		}
+
+		return data.RangeQueries(table.SourceQuery, data.NativePartitionPredicates(function, column, fanout)), nil
+
+	case table.Partitions > 1:
+		column := table.PartitionColumn
+		if column == "" {
+			var err error
+			column, err = app.leadingKeyColumn(ctx, transfer, source)
+			if err != nil {
+				return nil, err
+			}
+			if column == "" && table.AutoSplit {
+				return []string{table.SourceQuery}, nil
+			}
+			if column == "" {
+				return nil, fmt.Errorf("table %v.%v has no clustered index or primary key to split on; set partition_column", table.Schema, table.Table)
+			}
+		}
+
+		var sqlType string
+		err := transfer.Source.Db.QueryRowContext(
+			ctx,
+			`SELECT type_name(system_type_id) FROM sys.columns WHERE object_id = OBJECT_ID(@p1) AND name = @p2`,
+			source,
+			column,
+		).Scan(&sqlType)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("table %v.%v has no column %v", table.Schema, table.Table, column)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error looking up type of %v: %v", column, err)
+		}
+		if !isIntegerType(sqlType) && table.AutoSplit {
+			return []string{table.SourceQuery}, nil
+		}
+		if !isIntegerType(sqlType) {
+			return nil, fmt.Errorf("cannot split %v.%v on %v: key ranges need an integer column, not %v", table.Schema, table.Table, column, sqlType)
+		}
+
+		var min, max sql.NullInt64
+		boundsQuery := fmt.Sprintf(
+			"select convert(bigint, min(%v)), convert(bigint, max(%v)) from %v",
+			data.QuoteMssqlIdentifier(column),
+			data.QuoteMssqlIdentifier(column),
+			source,
+		)
+		err = transfer.Source.Db.QueryRowContext(ctx, boundsQuery).Scan(&min, &max)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key range, query was %v. error was: %v", boundsQuery, err)
+		}
+		if !min.Valid {
+			return []string{table.SourceQuery}, nil
+		}
+
+		return data.RangeQueries(table.SourceQuery, data.KeyRangePredicates(column, min.Int64, max.Int64, table.Partitions)), nil
+	}
+
+	return []string{table.SourceQuery}, nil
+}
+
+func isIntegerType(sqlType string) bool {
+	switch strings.ToLower(sqlType) {
+	case "bigint", "int", "smallint", "tinyint":
+		return true
+	}
+	return false
+}
+
+// leadingKeyColumn returns the first column of the clustered index, or of the
+// primary key when the table is a heap.
+func (app *application) leadingKeyColumn(ctx context.Context, transfer data.Transfer, source string) (string, error) {
+	var column string
+
+	err := transfer.Source.Db.QueryRowContext(
+		ctx,
+		`SELECT TOP 1 C.name
+	FROM sys.indexes AS I
+	INNER JOIN sys.index_columns AS IC ON IC.object_id = I.object_id AND IC.index_id = I.index_id AND IC.key_ordinal = 1
+	INNER JOIN sys.columns AS C ON C.object_id = IC.object_id AND C.column_id = IC.column_id
+	WHERE I.object_id = OBJECT_ID(@p1) AND (I.index_id = 1 OR I.is_primary_key = 1)
+	ORDER BY I.index_id`,
+		source,
+	).Scan(&column)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking up key of %v: %v", source, err)
+	}
+
+	return column, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
+	"github.com/sqlpipe/mssqltosnowflake/pkg"
+)
+
+type preflightCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// preflightChecklist runs checks in order. Once a check fails, the checks
+// that depend on it are reported as skipped rather than run.
+type preflightChecklist struct {
+	checks []preflightCheck
+}
+
+func (c *preflightChecklist) run(name string, ok bool, check func() error) bool {
+	if !ok {
+		c.checks = append(c.checks, preflightCheck{Name: name, Status: "skipped"})
+		return false
+	}
+
+	start := time.Now()
+	err := check()
+	result := preflightCheck{
+		Name:       name,
+		Status:     "pass",
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+
+	c.checks = append(c.checks, result)
+
+	return err == nil
+}
+
+func (c *preflightChecklist) passed() bool {
+	for _, check := range c.checks {
+		if check.Status != "pass" {
+			return false
+		}
+	}
+	return true
+}
+
+// preflightHandler takes the same body as createTransferHandler and checks
+// every connection and permission the transfer will need, without moving any
+// data.
+func (app *application) preflightHandler(w http.ResponseWriter, r *http.Request) {
+	var input transferInput
+
+	ctx, span := tracer.Start(r.Context(), "preflightHandler")
+	defer span.End()
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to read JSON, err: %v", err))
+		return
+	}
+
+	v := validator.New()
+
+	awsConfig, source, target := input.toConfig(v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	checklist := &preflightChecklist{}
+
+	loginCheck, catalogCheck, catalogQuery := "mssql_login", "mssql_read_sys_tables", "select count(*) from sys.tables"
+	if source.Type == data.SourceTypePostgresql {
+		loginCheck, catalogCheck, catalogQuery = "postgresql_login", "postgresql_read_pg_class", "select count(*) from pg_catalog.pg_class"
+	}
+
+	var sourceDb *sql.DB
+	sourceOk := checklist.run(loginCheck, true, func() error {
+		sourceDb, err = source.Open()
+		if err != nil {
+			return err
+		}
+		return sourceDb.PingContext(ctx)
+	})
+	if sourceDb != nil {
+		defer sourceDb.Close()
+	}
+
+	checklist.run(catalogCheck, sourceOk, func() error {
+		var tableCount int
+		return sourceDb.QueryRowContext(ctx, catalogQuery).Scan(&tableCount)
+	})
+
+	app.preflightS3(ctx, checklist, awsConfig)
+
+	var targetDb *sql.DB
+	targetOk := checklist.run("snowflake_jwt_login", true, func() error {
+		privKey, err := data.ReadPrivateKey(target.PrivateKeyLocation)
+		if err != nil {
+			return err
+		}
+		target.PrivateKey = *privKey
+
+		targetDb, err = target.Open("")
+		if err != nil {
+			return err
+		}
+		return targetDb.PingContext(ctx)
+	})
+	if targetDb != nil {
+		defer targetDb.Close()
+	}
+
+	// USE only lasts for the session, so pin one connection for the checks
+	// that follow it.
+	var conn *sql.Conn
+	if targetOk {
+		conn, err = targetDb.Conn(ctx)
+		if err != nil {
+			targetOk = false
+		} else {
+			defer conn.Close()
+		}
+	}
+
+	checklist.run("snowflake_use_warehouse", targetOk, func() error {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("use warehouse %v", target.Warehouse))
+		return err
+	})
+
+	checklist.run("snowflake_desc_storage_integration", targetOk, func() error {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(`desc integration "%v"`, target.StorageIntegration))
+		return err
+	})
+
+	checklist.run("snowflake_create_schema", targetOk, func() error {
+		randomChars, err := pkg.RandomCharacters(8)
+		if err != nil {
+			return err
+		}
+
+		probeSchema := fmt.Sprintf("%v.SQLPIPE_PREFLIGHT_%v", target.DbName, strings.ToUpper(randomChars))
+
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("create schema %v", probeSchema))
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("drop schema if exists %v", probeSchema))
+		if err != nil {
+			return fmt.Errorf("created probe schema %v but could not drop it: %v", probeSchema, err)
+		}
+
+		return nil
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"passed": checklist.passed(), "checks": checklist.checks}, nil)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, err)
+	}
+}
+
+func (app *application) preflightS3(ctx context.Context, checklist *preflightChecklist, awsConfig data.AwsConfig) {
+	s3Client, _, err := app.s3Clients()
+	var randomChars string
+	if err == nil {
+		randomChars, err = pkg.RandomCharacters(32)
+	}
+	if err != nil {
+		checklist.run("s3_put_probe", true, func() error { return err })
+		checklist.run("s3_get_probe", false, nil)
+		checklist.run("s3_delete_probe", false, nil)
+		return
+	}
+
+	key := fmt.Sprintf("%v/sqlpipe-preflight/%v", awsConfig.S3Dir, randomChars)
+	body := []byte("sqlpipe preflight probe")
+
+	putOk := checklist.run("s3_put_probe", true, func() error {
+		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(awsConfig.S3Bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(body),
+		})
+		return err
+	})
+
+	checklist.run("s3_get_probe", putOk, func() error {
+		output, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(awsConfig.S3Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		defer output.Body.Close()
+
+		got, err := io.ReadAll(output.Body)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, body) {
+			return errors.New("probe object read back with different contents")
+		}
+		return nil
+	})
+
+	checklist.run("s3_delete_probe", putOk, func() error {
+		_, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(awsConfig.S3Bucket),
+			Key:    aws.String(key),
+		})
+		return err
+	})
+}
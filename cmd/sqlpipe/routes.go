@@ -14,12 +14,17 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.readinessHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/healthcheck/ready", app.readinessHandler)
 
+	router.HandlerFunc(http.MethodPost, "/v1/preflight", app.preflightHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/transfers", app.createTransferHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/transfers/", app.showTransferHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/transfers/:id/logs", app.showTransferLogsHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/concurrency", app.showConcurrencyHandler)
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	return app.recoverPanic(router)
+	return app.recoverPanic(app.traceRequest(router))
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+)
+
+// applySample rewrites the source query of each discovered table to read
+// only the transfer's sample of it, widening the samples of tables that the
+// sample's foreign keys reference so every sampled child row keeps its
+// parent.
+func (app *application) applySample(ctx context.Context, transfer data.Transfer, queries []data.Query) error {
+	sample := *transfer.Sample
+
+	tables := map[string]int{}
+	for i, query := range queries {
+		tables[strings.ToLower(query.Schema+"."+query.Table)] = i
+	}
+
+	foreignKeys, err := app.foreignKeys(ctx, transfer, sample.ForeignKeys)
+	if err != nil {
+		return err
+	}
+
+	referencing := make([][]data.ForeignKey, len(queries))
+	for _, fk := range foreignKeys {
+		from, ok := tables[strings.ToLower(fk.FromSchema+"."+fk.FromTable)]
+		if !ok {
+			return fmt.Errorf("foreign key %v.%v is on %v.%v, which is not in the transfer", fk.Schema, fk.Name, fk.FromSchema, fk.FromTable)
+		}
+		to, ok := tables[strings.ToLower(fk.ToSchema+"."+fk.ToTable)]
+		if !ok {
+			return fmt.Errorf("foreign key %v.%v references %v.%v, which is not in the transfer", fk.Schema, fk.Name, fk.ToSchema, fk.ToTable)
+		}
+		if from == to {
+			return fmt.Errorf("foreign key %v.%v references its own table, which a sample cannot close over", fk.Schema, fk.Name)
+		}
+		referencing[to] = append(referencing[to], fk)
+	}
+
+	primaryKeys := make([][]string, len(queries))
+	for i, query := range queries {
+		if query.View || (sample.Rows == 0 && len(referencing[i]) == 0) {
+			continue
+		}
+		primaryKeys[i], err = app.primaryKeyColumns(ctx, transfer, query.Schema, query.Table)
+		if err != nil {
+			return err
+		}
+	}
+
+	sampled := func(i int) func(columns []string) string {
+		query := queries[i]
+		var opts data.TableOptions
+		for _, o := range transfer.TableOptions {
+			if o.Matches(query.Schema, query.Table) {
+				opts = o
+			}
+		}
+		return func(columns []string) string {
+			return opts.SampleQuery(query, columns, sample, primaryKeys[i])
+		}
+	}
+
+	// A referenced table's sample depends on the samples of the tables that
+	// reference it, so those are built first. visiting catches cycles.
+	built := make([]func(columns []string) string, len(queries))
+	visiting := make([]bool, len(queries))
+	var build func(i int) (func(columns []string) string, error)
+	build = func(i int) (func(columns []string) string, error) {
+		if built[i] != nil {
+			return built[i], nil
+		}
+		if visiting[i] {
+			return nil, fmt.Errorf("sample foreign keys form a cycle through %v.%v", queries[i].Schema, queries[i].Table)
+		}
+		visiting[i] = true
+		defer func() { visiting[i] = false }()
+
+		if len(referencing[i]) == 0 {
+			built[i] = sampled(i)
+			return built[i], nil
+		}
+
+		children := make([]func(columns []string) string, len(referencing[i]))
+		for j, fk := range referencing[i] {
+			child, err := build(tables[strings.ToLower(fk.FromSchema+"."+fk.FromTable)])
+			if err != nil {
+				return nil, err
+			}
+			children[j] = child
+		}
+
+		key := primaryKeys[i]
+		if len(key) == 0 {
+			key = referencing[i][0].RefColumns
+		}
+
+		query := queries[i]
+		own := sampled(i)
+		built[i] = func(columns []string) string {
+			return data.ClosureQuery(query, columns, key, own, referencing[i], children)
+		}
+		return built[i], nil
+	}
+
+	for i := range queries {
+		final, err := build(i)
+		if err != nil {
+			return err
+		}
+		queries[i].SourceQuery = final(queries[i].Columns)
+	}
+
+	return nil
+}
+
+// foreignKeys looks up the named schema-qualified foreign keys.
+func (app *application) foreignKeys(ctx context.Context, transfer data.Transfer, names []string) ([]data.ForeignKey, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	all, err := app.sourceForeignKeys(ctx, transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys := []data.ForeignKey{}
+names:
+	for _, name := range names {
+		for _, fk := range all {
+			if strings.EqualFold(fk.Schema+"."+fk.Name, name) {
+				foreignKeys = append(foreignKeys, fk)
+				continue names
+			}
+		}
+		return nil, fmt.Errorf("foreign key %v does not exist", name)
+	}
+
+	return foreignKeys, nil
+}
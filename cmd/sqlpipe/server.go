@@ -27,8 +27,6 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
-		app.putLogEvents(fmt.Sprintf("shutting down because of signal: %v", s))
-
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
@@ -42,6 +40,15 @@ func (app *application) serve() error {
 		})
 
 		app.wg.Wait()
+
+		if app.tracerProvider != nil {
+			err = app.tracerProvider.Shutdown(context.Background())
+			if err != nil {
+				shutdownError <- err
+				return
+			}
+		}
+
 		shutdownError <- nil
 	}()
 
@@ -63,5 +70,5 @@ func (app *application) serve() error {
 		"addr": srv.Addr,
 	})
 
-	return nil
+	return app.closeLogSinks()
 }
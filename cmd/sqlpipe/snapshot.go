@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+)
+
+// beginSnapshot opens the SNAPSHOT isolation transaction every table is read
+// through in snapshot consistency mode. A transaction lives on a single
+// connection, so reads through it run one at a time.
+func (app *application) beginSnapshot(ctx context.Context, transfer data.Transfer) (*sql.Tx, error) {
+	var state int
+	err := transfer.Source.Db.QueryRowContext(
+		ctx,
+		`SELECT snapshot_isolation_state FROM sys.databases WHERE name = DB_NAME()`,
+	).Scan(&state)
+	if err != nil {
+		return nil, fmt.Errorf("error checking snapshot isolation state: %v", err)
+	}
+
+	// 1 is ON; 2 and 3 are transitions in progress that cannot be used yet.
+	if state != 1 {
+		return nil, fmt.Errorf(
+			"consistency snapshot needs ALLOW_SNAPSHOT_ISOLATION ON for database %v (run ALTER DATABASE %v SET ALLOW_SNAPSHOT_ISOLATION ON)",
+			transfer.Source.DbName,
+			data.QuoteMssqlIdentifier(transfer.Source.DbName),
+		)
+	}
+
+	tx, err := transfer.Source.Db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSnapshot})
+	if err != nil {
+		return nil, fmt.Errorf("error starting snapshot transaction: %v", err)
+	}
+
+	// A snapshot's point in time is fixed by the first read inside it, not
+	// by BEGIN TRAN, so read something now rather than with the first table.
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT count(*) FROM sys.objects`).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error starting snapshot transaction: %v", err)
+	}
+
+	return tx, nil
+}
+
+// scanSourceRow reads a single row through transfer.SourceReader, so values
+// such as watermarks and change versions agree with the rows extracted.
+func scanSourceRow(ctx context.Context, transfer data.Transfer, query string, args []interface{}, dest ...interface{}) error {
+	err := transfer.SourceReads.Acquire(ctx, 1)
+	if err != nil {
+		return err
+	}
+	defer transfer.SourceReads.Release(1)
+
+	return transfer.SourceReader.QueryRowContext(ctx, query, args...).Scan(dest...)
+}
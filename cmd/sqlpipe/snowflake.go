@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func startSnowflakeSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	return tracer.Start(
+		ctx,
+		"snowflake.statement",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String("snowflake"),
+			semconv.DBStatement(query),
+		),
+	)
+}
+
+func execSnowflake(ctx context.Context, db *sql.DB, query string) (sql.Result, error) {
+	ctx, span := startSnowflakeSpan(ctx, query)
+	defer span.End()
+
+	result, err := db.ExecContext(ctx, query)
+	recordSpanError(span, err)
+
+	return result, err
+}
+
+func queryRowSnowflake(ctx context.Context, db *sql.DB, query string, dest ...interface{}) error {
+	ctx, span := startSnowflakeSpan(ctx, query)
+	defer span.End()
+
+	err := db.QueryRowContext(ctx, query).Scan(dest...)
+	recordSpanError(span, err)
+
+	return err
+}
+
+func querySnowflake(ctx context.Context, db *sql.DB, query string) (*sql.Rows, error) {
+	ctx, span := startSnowflakeSpan(ctx, query)
+	defer span.End()
+
+	rows, err := db.QueryContext(ctx, query)
+	recordSpanError(span, err)
+
+	return rows, err
+}
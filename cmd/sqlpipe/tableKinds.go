@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+)
+
+// applyTableKinds applies the rules for special SQL Server tables to the
+// filtered queries. A system-versioned temporal table brings its history
+// table along unless exclude_tables names it. Tables with computed, hidden
+// period or sparse column set columns are read through an explicit column
+// list, and memory-optimized tables take the SNAPSHOT hint inside a snapshot
+// transaction, which they cannot be read in otherwise.
+func (app *application) applyTableKinds(
+	ctx context.Context,
+	transfer data.Transfer,
+	discovered []data.Query,
+	queries []data.Query,
+	skipped []data.SkippedTable,
+) ([]data.Query, []data.SkippedTable, error) {
+	included := map[string]bool{}
+	for _, query := range queries {
+		included[strings.ToLower(query.Schema+"."+query.Table)] = true
+	}
+
+	for i, query := range queries {
+		if query.Temporal != data.TemporalSystemVersioned || query.HistoryTable == "" {
+			continue
+		}
+		history := strings.ToLower(query.HistorySchema + "." + query.HistoryTable)
+		if included[history] {
+			continue
+		}
+
+		for j, s := range skipped {
+			if !strings.EqualFold(s.Schema+"."+s.Table, history) {
+				continue
+			}
+			if s.Reason != data.SkippedNotIncluded {
+				queries[i].Notes = append(queries[i].Notes, fmt.Sprintf("history table %v.%v is skipped: %v", s.Schema, s.Table, s.Reason))
+				break
+			}
+			for _, d := range discovered {
+				if strings.EqualFold(d.Schema+"."+d.Table, history) {
+					d.Notes = append(d.Notes, fmt.Sprintf("history table of %v.%v", query.Schema, query.Table))
+					queries = append(queries, d)
+					included[history] = true
+					skipped = append(skipped[:j], skipped[j+1:]...)
+					break
+				}
+			}
+			break
+		}
+	}
+
+	columns, err := app.catalogColumns(ctx, transfer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, query := range queries {
+		if query.View {
+			continue
+		}
+
+		rewrite := false
+		if query.MemoryOptimized && transfer.Consistency == data.ConsistencySnapshot {
+			queries[i].TableHint = "SNAPSHOT"
+			rewrite = true
+		}
+
+		tableColumns, ok := columns[strings.ToLower(query.Schema+"."+query.Table)]
+		if ok {
+			projection, notes := data.ProjectColumns(tableColumns, transfer.PeriodColumns, transfer.ComputedColumns)
+			if len(projection) == 0 {
+				return nil, nil, fmt.Errorf("table %v.%v has no columns left to extract", query.Schema, query.Table)
+			}
+			queries[i].Columns = projection
+			queries[i].Notes = append(queries[i].Notes, notes...)
+			rewrite = true
+		}
+
+		if rewrite {
+			queries[i].SourceQuery = data.TableOptions{}.SourceQuery(transfer.Source.Driver(), queries[i], queries[i].Columns)
+		}
+	}
+
+	return queries, skipped, nil
+}
+
+// catalogColumns returns, in column order, the columns of each user table
+// that has computed, hidden or column set columns, keyed by lower cased
+// schema.table.
+func (app *application) catalogColumns(ctx context.Context, transfer data.Transfer) (map[string][]data.CatalogColumn, error) {
+	rows, err := transfer.Source.Db.QueryContext(
+		ctx,
+		`SELECT S.name, T.name, C.name, C.is_computed, C.is_column_set, C.is_hidden
+	FROM sys.columns AS C
+	INNER JOIN sys.tables AS T ON T.object_id = C.object_id
+	INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id
+	WHERE T.is_ms_shipped = 0
+	AND EXISTS (
+		SELECT 1 FROM sys.columns AS X
+		WHERE X.object_id = C.object_id AND (X.is_computed = 1 OR X.is_column_set = 1 OR X.is_hidden = 1)
+	)
+	ORDER BY S.name, T.name, C.column_id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying special columns: %v", err)
+	}
+	defer rows.Close()
+
+	columns := map[string][]data.CatalogColumn{}
+	for rows.Next() {
+		var schema, table string
+		var column data.CatalogColumn
+		err := rows.Scan(&schema, &table, &column.Name, &column.Computed, &column.ColumnSet, &column.Hidden)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning special column: %v", err)
+		}
+		key := strings.ToLower(schema + "." + table)
+		columns[key] = append(columns[key], column)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over special columns: %v", err)
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// transferTable extracts one query from the source, loads it into the staging
+// schema and swaps it into the prod schema.
+func (app *application) transferTable(
+	ctx context.Context,
+	logger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	prodSchemaName string,
+	queryIndex int,
+	table data.Query,
+) (err error) {
+	ctx, span := tracer.Start(
+		ctx,
+		"transferTable",
+		trace.WithAttributes(transferAttributes(transfer)...),
+		trace.WithAttributes(tableAttributes(table)...),
+	)
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	tableLogger := logger.With(tableLogProperties(table))
+
+	if table.Mode == data.ModeCdc {
+		return app.transferCdcTable(ctx, tableLogger, transfer, targetDb, stagingSchemaName, prodSchemaName, queryIndex, table)
+	}
+
+	var load incrementalLoad
+	switch table.Mode {
+	case data.ModeIncremental:
+		load, err = app.prepareIncremental(ctx, transfer, targetDb, prodSchemaName, &table)
+	case data.ModeChangeTracking:
+		load, err = app.prepareChangeTracking(ctx, transfer, targetDb, prodSchemaName, &table)
+	}
+	if err != nil {
+		return err
+	}
+
+	if load.stateColumn != "" {
+		tableLogger.PrintInfo("prepared incremental load", map[string]string{
+			"phase": "extract",
+			"mode":  table.Mode,
+			"merge": strconv.FormatBool(load.merge),
+			"state": load.state,
+		})
+	}
+
+	cleanedTableName, unquotedTableName := table.TargetName()
+	s3DirName := CleanString(unquotedTableName)
+
+	sourceQueries, err := app.splitSourceQuery(ctx, transfer, table)
+	if err != nil {
+		return err
+	}
+
+	var metadata map[string]data.ColumnMetadata
+	if table.Schema != "" && !table.View && transfer.Source.Type != data.SourceTypePostgresql {
+		metadata, err = app.columnMetadata(ctx, transfer, table.Schema, table.Table)
+		if err != nil {
+			return err
+		}
+	}
+
+	staged, err := app.stageQuery(ctx, tableLogger, transfer, targetDb, stagingSchemaName, cleanedTableName, s3DirName, metadata, sourceQueries...)
+	app.recordRowCounts(transfer, queryIndex, staged)
+	if err != nil {
+		return err
+	}
+
+	if len(staged.unsupportedDefaults) > 0 {
+		tableLogger.PrintWarn("could not translate column defaults", map[string]string{
+			"phase":   "create_table",
+			"columns": strings.Join(staged.unsupportedDefaults, "; "),
+		})
+		app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+			if queryIndex < len(t.Queries) {
+				t.Queries[queryIndex].UnsupportedDefaults = staged.unsupportedDefaults
+			}
+		})
+	}
+	transfer.Queries[queryIndex].TargetCreateTableQuery = staged.createTableQuery
+	columnInfo := staged.columnInfo
+
+	if transfer.ValidateChecksums {
+		app.validateChecksums(ctx, tableLogger, transfer, targetDb, stagingSchemaName, cleanedTableName, queryIndex, table.SourceQuery, columnInfo)
+	}
+
+	if len(load.keys) > 0 {
+		extracted := map[string]bool{}
+		for _, column := range columnInfo.TargetColumnNames {
+			extracted[column] = true
+		}
+		for _, key := range load.keys {
+			if !extracted[data.SnowflakeColumnName(key)] {
+				return fmt.Errorf("key column %v is not in the extracted columns", key)
+			}
+		}
+	}
+
+	if load.deletesQuery != "" {
+		err = app.applyDeletes(ctx, tableLogger, transfer, targetDb, stagingSchemaName, prodSchemaName, cleanedTableName, unquotedTableName, load)
+		if err != nil {
+			return err
+		}
+	}
+
+	if load.merge {
+		tableLogger.PrintInfo("finished copy, merging into prod table", map[string]string{"phase": "merge"})
+
+		mergeIntoProdQuery := mergeQuery(
+			fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, prodSchemaName, cleanedTableName),
+			fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, stagingSchemaName, cleanedTableName),
+			columnInfo.TargetColumnNames,
+			load.keys,
+		)
+		_, err = execSnowflake(ctx, targetDb, mergeIntoProdQuery)
+		if err != nil {
+			return fmt.Errorf("error running merge into prod table, query was %v, error was %v", mergeIntoProdQuery, err)
+		}
+	} else {
+		err = app.swapIntoProd(ctx, tableLogger, transfer, targetDb, stagingSchemaName, prodSchemaName, cleanedTableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if load.stateColumn != "" && load.state != "" {
+		tableLogger.PrintDebug("saving state", map[string]string{
+			"phase": "state",
+			"state": load.state,
+		})
+		err = app.saveState(ctx, targetDb, transfer, prodSchemaName, unquotedTableName, table, load.stateColumn, load.state)
+		if err != nil {
+			return err
+		}
+	}
+
+	tableLogger.PrintInfo("finished table", map[string]string{"phase": "swap"})
+
+	return nil
+}
+
+// stagedTable describes what stageQuery loaded into the staging schema.
+// rows counts what was streamed to S3, rowsLoaded what COPY reported and
+// rowsInStaging what the staging table holds afterwards.
+type stagedTable struct {
+	columnInfo       data.ColumnInfo
+	createTableQuery string
+	rows             int64
+	rowsLoaded       int64
+	rowsInStaging    int64
+	counted          bool
+	// unsupportedDefaults lists the source defaults the staging table
+	// could not carry over.
+	unsupportedDefaults []string
+}
+
+// stageQuery runs sourceQueries against the source, streams the rows to S3 as
+// CSV under s3DirName and copies them into a new table in the staging schema.
+// Several queries, one per key range or partition of the same table, are read
+// concurrently; every source read goes through transfer.SourceReader and
+// holds a slot of transfer.SourceReads. metadata, when given, carries the
+// source table's column defaults and identity over to the staging table.
+func (app *application) stageQuery(
+	ctx context.Context,
+	tableLogger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	cleanedTableName string,
+	s3DirName string,
+	metadata map[string]data.ColumnMetadata,
+	sourceQueries ...string,
+) (staged stagedTable, err error) {
+	var stats extractStats
+
+	if len(sourceQueries) == 1 {
+		err = transfer.SourceReads.Acquire(ctx, 1)
+		if err != nil {
+			return staged, err
+		}
+		defer transfer.SourceReads.Release(1)
+
+		tableLogger.PrintInfo("running extraction query", map[string]string{"phase": "extract"})
+		transferRows, err := transfer.SourceReader.QueryContext(ctx, sourceQueries[0])
+		if err != nil {
+			return staged, fmt.Errorf("error running extraction query: %v", err)
+		}
+		defer transferRows.Close()
+
+		staged.columnInfo, err = readColumnInfo(transfer.Source.Driver(), transferRows)
+		if err != nil {
+			return staged, err
+		}
+		if metadata != nil {
+			staged.unsupportedDefaults = data.ApplyColumnMetadata(&staged.columnInfo, metadata)
+		}
+
+		staged.createTableQuery, err = app.createStagingTable(ctx, tableLogger, targetDb, stagingSchemaName, cleanedTableName, staged.columnInfo)
+		if err != nil {
+			return staged, err
+		}
+
+		stats, err = app.extractToS3(ctx, tableLogger, transfer, transferRows, staged.columnInfo, s3DirName)
+		if err != nil {
+			return staged, err
+		}
+	} else {
+		// Column types come from an empty read of the first range so the
+		// staging table exists before any range finishes.
+		probeQuery := fmt.Sprintf("select * from (%v) as sqlpipe_probe where 1 = 0", sourceQueries[0])
+		err = transfer.SourceReads.Acquire(ctx, 1)
+		if err != nil {
+			return staged, err
+		}
+		probeRows, err := transfer.SourceReader.QueryContext(ctx, probeQuery)
+		if err != nil {
+			transfer.SourceReads.Release(1)
+			return staged, fmt.Errorf("error reading column types, query was %v. error was: %v", probeQuery, err)
+		}
+		staged.columnInfo, err = readColumnInfo(transfer.Source.Driver(), probeRows)
+		probeRows.Close()
+		transfer.SourceReads.Release(1)
+		if err != nil {
+			return staged, err
+		}
+		if metadata != nil {
+			staged.unsupportedDefaults = data.ApplyColumnMetadata(&staged.columnInfo, metadata)
+		}
+
+		staged.createTableQuery, err = app.createStagingTable(ctx, tableLogger, targetDb, stagingSchemaName, cleanedTableName, staged.columnInfo)
+		if err != nil {
+			return staged, err
+		}
+
+		tableLogger.PrintInfo("extracting ranges", map[string]string{
+			"phase":  "extract",
+			"ranges": strconv.Itoa(len(sourceQueries)),
+		})
+
+		var mu sync.Mutex
+		g, rangeCtx := errgroup.WithContext(ctx)
+		for i, sourceQuery := range sourceQueries {
+			rangeLogger := tableLogger.With(map[string]string{"range": strconv.Itoa(i + 1)})
+			sourceQuery := sourceQuery
+
+			g.Go(func() error {
+				err := transfer.SourceReads.Acquire(rangeCtx, 1)
+				if err != nil {
+					return err
+				}
+				defer transfer.SourceReads.Release(1)
+
+				rangeLogger.PrintDebug("running extraction query", map[string]string{"phase": "extract"})
+				rows, err := transfer.SourceReader.QueryContext(rangeCtx, sourceQuery)
+				if err != nil {
+					return fmt.Errorf("error running extraction query: %v", err)
+				}
+				defer rows.Close()
+
+				rangeStats, err := app.extractToS3(rangeCtx, rangeLogger, transfer, rows, staged.columnInfo, s3DirName)
+				if err != nil {
+					return err
+				}
+
+				mu.Lock()
+				stats.add(rangeStats)
+				mu.Unlock()
+
+				return nil
+			})
+		}
+
+		err = g.Wait()
+		if err != nil {
+			return staged, err
+		}
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("sqlpipe.rows", stats.rows),
+		attribute.Int64("sqlpipe.mssql_read_ms", stats.readTime.Milliseconds()),
+		attribute.Int64("sqlpipe.csv_format_ms", stats.formatTime.Milliseconds()),
+	)
+
+	tableLogger.PrintInfo("finished upload, starting copy into staging table", map[string]string{
+		"phase": "copy",
+		"rows":  strconv.FormatInt(stats.rows, 10),
+	})
+
+	loadingQuery := fmt.Sprintf(
+		`copy into %v.%v from s3://%v/%v STORAGE_INTEGRATION = "%v" file_format = (format_name = SQLPIPE_CSV)`,
+		stagingSchemaName,
+		cleanedTableName,
+		transfer.AwsConfig.S3Bucket,
+		fmt.Sprintf("%v/%v/%v/", transfer.AwsConfig.S3Dir, transfer.Id, s3DirName),
+		transfer.Target.StorageIntegration,
+		// transfer.Target.FileFormatName,
+	)
+	staged.rows = stats.rows
+
+	staged.rowsLoaded, err = copyIntoStaging(ctx, targetDb, loadingQuery)
+	if err != nil {
+		return staged, fmt.Errorf("error running copy command, query was %v, error was %v", loadingQuery, err)
+	}
+
+	countQuery := fmt.Sprintf(`select count(*) from %v.%v`, stagingSchemaName, cleanedTableName)
+	err = queryRowSnowflake(ctx, targetDb, countQuery, &staged.rowsInStaging)
+	if err != nil {
+		return staged, fmt.Errorf("error counting staged rows, query was %v, error was %v", countQuery, err)
+	}
+	staged.counted = true
+
+	if staged.rows != staged.rowsLoaded || staged.rows != staged.rowsInStaging {
+		mismatch := fmt.Errorf(
+			"row count mismatch for %v: %d rows extracted, %d loaded by copy, %d in staging table",
+			cleanedTableName,
+			staged.rows,
+			staged.rowsLoaded,
+			staged.rowsInStaging,
+		)
+		if transfer.OnRowCountMismatch != data.RowCountMismatchWarn {
+			return staged, mismatch
+		}
+		tableLogger.PrintWarn(mismatch.Error(), map[string]string{"phase": "copy"})
+	}
+
+	return staged, nil
+}
+
+// copyIntoStaging runs a COPY INTO and returns the sum of rows_loaded over
+// the files it reports.
+func copyIntoStaging(ctx context.Context, targetDb *sql.DB, loadingQuery string) (int64, error) {
+	rows, err := querySnowflake(ctx, targetDb, loadingQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	// With no files to load COPY returns a lone status column.
+	rowsLoadedIndex := -1
+	for i, column := range columns {
+		if strings.EqualFold(column, "rows_loaded") {
+			rowsLoadedIndex = i
+		}
+	}
+
+	vals := make([]sql.NullString, len(columns))
+	valPtrs := make([]interface{}, len(columns))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	var loaded int64
+	for rows.Next() {
+		err = rows.Scan(valPtrs...)
+		if err != nil {
+			return 0, err
+		}
+		if rowsLoadedIndex < 0 || !vals[rowsLoadedIndex].Valid {
+			continue
+		}
+		n, err := strconv.ParseInt(vals[rowsLoadedIndex].String, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected rows_loaded %q in copy result", vals[rowsLoadedIndex].String)
+		}
+		loaded += n
+	}
+
+	return loaded, rows.Err()
+}
+
+// recordRowCounts stores the counts of a staged table on its query's status.
+func (app *application) recordRowCounts(transfer data.Transfer, queryIndex int, staged stagedTable) {
+	if !staged.counted {
+		return
+	}
+
+	app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+		if queryIndex < len(t.Queries) {
+			t.Queries[queryIndex].RowsExtracted = staged.rows
+			t.Queries[queryIndex].RowsLoaded = staged.rowsLoaded
+			t.Queries[queryIndex].RowsInStaging = staged.rowsInStaging
+		}
+	})
+}
+
+func readColumnInfo(driver data.SourceDriver, transferRows *sql.Rows) (data.ColumnInfo, error) {
+	columnInfo := data.ColumnInfo{
+		ColumnNames:         []string{},
+		ColumnDbTypes:       []string{},
+		ColumnScanTypes:     []reflect.Type{},
+		ColumnNamesAndTypes: []string{},
+		ColumnPrecisions:    []int64{},
+		ColumnScales:        []int64{},
+		ColumnLengths:       []int64{},
+	}
+
+	colTypesFromDriver, err := transferRows.ColumnTypes()
+	if err != nil {
+		return columnInfo, fmt.Errorf("error getting column types: %v", err)
+	}
+
+	for _, colType := range colTypesFromDriver {
+		columnInfo.ColumnNames = append(columnInfo.ColumnNames, colType.Name())
+		columnInfo.ColumnDbTypes = append(columnInfo.ColumnDbTypes, colType.DatabaseTypeName())
+		columnInfo.ColumnScanTypes = append(columnInfo.ColumnScanTypes, colType.ScanType())
+
+		colLen, _ := colType.Length()
+		columnInfo.ColumnLengths = append(columnInfo.ColumnLengths, colLen)
+
+		// Columns the driver cannot vouch for stay nullable.
+		nullable, ok := colType.Nullable()
+		columnInfo.ColumnNullables = append(columnInfo.ColumnNullables, nullable || !ok)
+
+		precision, scale, _ := colType.DecimalSize()
+		columnInfo.ColumnPrecisions = append(columnInfo.ColumnPrecisions, precision)
+		columnInfo.ColumnScales = append(columnInfo.ColumnScales, scale)
+	}
+
+	columnInfo.NumCols = len(columnInfo.ColumnNames)
+
+	columnInfo, err = data.GetCreateTableTypes(driver, columnInfo)
+	if err != nil {
+		return columnInfo, fmt.Errorf("error getting create table types: %v", err)
+	}
+
+	return columnInfo, nil
+}
+
+func (app *application) createStagingTable(
+	ctx context.Context,
+	tableLogger *jsonlog.Logger,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	cleanedTableName string,
+	columnInfo data.ColumnInfo,
+) (string, error) {
+	createTablequery := fmt.Sprintf(
+		`create table if not exists %v.%v (`,
+		stagingSchemaName,
+		cleanedTableName,
+	)
+
+	for i, colNameAndType := range columnInfo.ColumnNamesAndTypes {
+		if i < len(columnInfo.ColumnDefaults) && columnInfo.ColumnDefaults[i] != "" {
+			colNameAndType = colNameAndType + " " + columnInfo.ColumnDefaults[i]
+		}
+		if !columnInfo.ColumnNullables[i] {
+			colNameAndType = colNameAndType + " NOT NULL"
+		}
+		createTablequery = createTablequery + fmt.Sprintf("%v, ", colNameAndType)
+	}
+
+	createTablequery = strings.TrimSuffix(createTablequery, ", ")
+	createTablequery = createTablequery + ");"
+
+	tableLogger.PrintInfo("creating staging table", map[string]string{
+		"phase":        "create_table",
+		"target_table": fmt.Sprintf("%v.%v", stagingSchemaName, cleanedTableName),
+	})
+
+	_, err := execSnowflake(ctx, targetDb, createTablequery)
+	if err != nil {
+		return createTablequery, fmt.Errorf("error running create table query, query was %v. error was: %v", createTablequery, err)
+	}
+
+	return createTablequery, nil
+}
+
+type extractStats struct {
+	rows       int64
+	readTime   time.Duration
+	formatTime time.Duration
+}
+
+func (stats *extractStats) add(other extractStats) {
+	stats.rows += other.rows
+	stats.readTime += other.readTime
+	stats.formatTime += other.formatTime
+}
+
+// extractToS3 writes transferRows to S3 as CSV files of about the transfer's
+// chunk size.
+func (app *application) extractToS3(
+	ctx context.Context,
+	tableLogger *jsonlog.Logger,
+	transfer data.Transfer,
+	transferRows *sql.Rows,
+	columnInfo data.ColumnInfo,
+	s3DirName string,
+) (stats extractStats, err error) {
+	numCols := columnInfo.NumCols
+
+	_, uploader, err := app.s3Clients()
+	if err != nil {
+		return stats, fmt.Errorf("error creating s3 uploader: %v", err)
+	}
+
+	var stringBuilder strings.Builder
+
+	vals := make([]interface{}, numCols)
+	valPtrs := make([]interface{}, numCols)
+	formatters := make([]func(value interface{}) (string, error), numCols)
+	dataInRam := false
+
+	for i := 0; i < numCols; i++ {
+		valPtrs[i] = &vals[i]
+
+		var ok bool
+		formatters[i], ok = transfer.Source.Driver().Formatter(columnInfo.ColumnDbTypes[i])
+		if !ok {
+			return stats, fmt.Errorf("no formatter for db type %v", columnInfo.ColumnDbTypes[i])
+		}
+	}
+
+	tableLogger.PrintInfo("streaming rows to s3", map[string]string{"phase": "extract"})
+
+	// Chunks upload in the background while the next one is read. They must
+	// all be in S3 before the caller copies the directory into Snowflake.
+	uploads, uploadCtx := errgroup.WithContext(ctx)
+	defer uploads.Wait()
+
+	rowVals := make([]string, numCols)
+	rowNulls := make([]bool, numCols)
+	for {
+		readStart := time.Now()
+		if !transferRows.Next() {
+			stats.readTime += time.Since(readStart)
+			break
+		}
+		err = transferRows.Scan(valPtrs...)
+		if err != nil {
+			return stats, fmt.Errorf("error scanning source row: %v", err)
+		}
+		stats.readTime += time.Since(readStart)
+		stats.rows++
+
+		formatStart := time.Now()
+		for j := 0; j < numCols; j++ {
+			rowNulls[j] = vals[j] == nil
+			rowVals[j], err = formatters[j](vals[j])
+			if err != nil {
+				return stats, fmt.Errorf("error formatting values for csv file: %v", err)
+			}
+		}
+		data.AppendCsvRecord(&stringBuilder, rowVals, rowNulls)
+		stats.formatTime += time.Since(formatStart)
+
+		dataInRam = true
+
+		if data.TurboInsertChecker(stringBuilder.Len(), transfer.AwsConfig.ChunkSize) {
+			tableLogger.PrintDebug("uploading chunk", map[string]string{
+				"phase": "upload",
+				"bytes": strconv.Itoa(stringBuilder.Len()),
+			})
+			// reader, err := data.GetGzipReader(stringBuilder.String())
+			// if err != nil {
+			// 	return stats, fmt.Errorf("error getting gzip reader: %v", err)
+			// }
+
+			body := stringBuilder.String()
+			uploads.Go(func() error {
+				err := data.UploadAndTransfer(uploadCtx, body, uploader, s3DirName, transfer.Id, transfer.AwsConfig.S3Dir, transfer.AwsConfig.S3Bucket)
+				if err != nil {
+					return fmt.Errorf("error running upload and transfer: %v", err)
+				}
+				return nil
+			})
+			dataInRam = false
+			stringBuilder.Reset()
+		}
+	}
+
+	// A read that fails part way ends the loop like the last row does, and
+	// would otherwise be reported as a short but successful extract.
+	err = transferRows.Err()
+	if err != nil {
+		return stats, fmt.Errorf("error iterating over source rows: %v", err)
+	}
+
+	if dataInRam {
+		tableLogger.PrintDebug("uploading final chunk", map[string]string{
+			"phase": "upload",
+			"bytes": strconv.Itoa(stringBuilder.Len()),
+		})
+		// reader, err := data.GetGzipReader(stringBuilder.String())
+		// if err != nil {
+		// 	return stats, fmt.Errorf("error getting gzip reader: %v", err)
+		// }
+		err = data.UploadAndTransfer(uploadCtx, stringBuilder.String(), uploader, s3DirName, transfer.Id, transfer.AwsConfig.S3Dir, transfer.AwsConfig.S3Bucket)
+		if err != nil {
+			return stats, fmt.Errorf("error running upload and transfer: %v", err)
+		}
+	}
+
+	return stats, uploads.Wait()
+}
+
+// swapIntoProd replaces the prod table with the freshly loaded staging table.
+func (app *application) swapIntoProd(
+	ctx context.Context,
+	tableLogger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	prodSchemaName string,
+	cleanedTableName string,
+) error {
+	tableLogger.PrintInfo("finished copy, dropping table in prod schema", map[string]string{"phase": "swap"})
+
+	dropTableInProdQuery := fmt.Sprintf(
+		`drop table if exists %v.%v.%v;`,
+		transfer.Target.DbName,
+		prodSchemaName,
+		cleanedTableName,
+	)
+	_, err := execSnowflake(ctx, targetDb, dropTableInProdQuery)
+	if err != nil {
+		return fmt.Errorf("error running command to drop table in prod schema, query was %v, error was %v", dropTableInProdQuery, err)
+	}
+
+	tableLogger.PrintDebug("moving staging table to prod schema", map[string]string{"phase": "swap"})
+
+	moveTableFromStagingToProdSchema := fmt.Sprintf(
+		`alter table %v.%v.%v rename to %v.%v.%v;`,
+		transfer.Target.DbName,
+		stagingSchemaName,
+		cleanedTableName,
+		transfer.Target.DbName,
+		prodSchemaName,
+		cleanedTableName,
+	)
+	_, err = execSnowflake(ctx, targetDb, moveTableFromStagingToProdSchema)
+	if err != nil {
+		return fmt.Errorf("error running command to move table from staging to prod schema, query was %v, error was %v", moveTableFromStagingToProdSchema, err)
+	}
+
+	return nil
+}
+
+func tableLogProperties(table data.Query) map[string]string {
+	if table.TargetTable != "" {
+		return map[string]string{"target_table": table.TargetTable}
+	}
+	return map[string]string{
+		"schema": table.Schema,
+		"table":  table.Table,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+)
+
+var tracer = otel.Tracer("github.com/sqlpipe/mssqltosnowflake/cmd/sqlpipe")
+
+// setupTracing installs the global propagator and, when an OTLP endpoint is
+// configured, a tracer provider that exports to it. With no endpoint the
+// global no-op provider is left in place and spans cost next to nothing.
+func setupTracing(cfg cfg) (*sdktrace.TracerProvider, error) {
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	)
+
+	if cfg.otel.endpoint == "" {
+		return nil, nil
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(cfg.otel.endpoint),
+	}
+	if cfg.otel.insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating otlp exporter: %v", err)
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("sqlpipe"),
+		semconv.ServiceVersion(version),
+	)
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(
+			sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.otel.sampleRatio)),
+		),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+
+	return tracerProvider, nil
+}
+
+func transferAttributes(transfer data.Transfer) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("sqlpipe.transfer_id", transfer.Id),
+		attribute.String("sqlpipe.source_type", transfer.Source.Driver().Name()),
+		attribute.String("sqlpipe.source_db", transfer.Source.DbName),
+		attribute.String("sqlpipe.target_db", transfer.Target.DbName),
+	}
+}
+
+func tableAttributes(table data.Query) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("sqlpipe.schema", table.Schema),
+		attribute.String("sqlpipe.table", table.Table),
+		attribute.String("sqlpipe.target_table", table.TargetTable),
+	}
+}
+
+func recordSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -2,26 +2,22 @@ package main
 
 import (
 	"context"
-	"reflect"
 	"strings"
 	"unicode"
 
 	_ "github.com/calmitchell617/go-mssqldb"
-	"github.com/snowflakedb/gosnowflake"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 
-	"crypto/rsa"
-	"crypto/x509"
-	"database/sql"
-	"encoding/csv"
-	"encoding/pem"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/julienschmidt/httprouter"
 	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
 	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
 	"github.com/sqlpipe/mssqltosnowflake/pkg"
 )
@@ -31,7 +27,7 @@ func (app *application) showTransferHandler(w http.ResponseWriter, r *http.Reque
 
 	id := app.readString(qs, "id", "")
 
-	transfer, ok := app.transferMap[id]
+	transfer, ok := app.transfers.Get(id)
 	if !ok {
 		app.notFoundResponse(w, r)
 		return
@@ -43,40 +39,67 @@ func (app *application) showTransferHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		AwsConfigS3Bucket        string `json:"aws_config_s3_bucket"`
-		AwsConfigS3Dir           string `json:"aws_config_s3_dir"`
-		AwsConfigRegion          string `json:"aws_config_region"`
-		SourceHost               string `json:"source_host"`
-		SourcePort               int    `json:"source_port"`
-		SourceUsername           string `json:"source_username"`
-		SourcePassword           string `json:"source_password"`
-		SourceDbName             string `json:"source_db_name"`
-		TargetAccountId          string `json:"target_account_id"`
-		TargetUsername           string `json:"target_username"`
-		TargetPrivateKeyLocation string `json:"target_private_key_location"`
-		TargetRole               string `json:"target_role"`
-		TargetWarehouse          string `json:"target_warehouse"`
-		TargetAwsRegion          string `json:"target_aws_region"`
-		TargetDbName             string `json:"target_db_name"`
-		TargetStorageIntegration string `json:"target_storage_integration"`
-		TargetDivisionCode       string `json:"target_division_code"`
-		TargetRootName           string `json:"target_root_name"`
-		TargetFileFormatName     string `json:"target_file_format_name"`
-		Concurrency              int    `json:"concurrency"`
-		ChunkSize                int    `json:"chunk_size"`
-		// ServerName               string `json:"server_name"`
-	}
-
-	err := app.readJSON(w, r, &input)
-	if err != nil {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to read JSON, err: %v", err))
-		return
-	}
-
-	v := validator.New()
+// transferInput is the request body accepted by createTransferHandler and
+// preflightHandler.
+type transferInput struct {
+	AwsConfigS3Bucket            string              `json:"aws_config_s3_bucket"`
+	AwsConfigS3Dir               string              `json:"aws_config_s3_dir"`
+	AwsConfigRegion              string              `json:"aws_config_region"`
+	SourceType                   string              `json:"source_type"`
+	SourceHost                   string              `json:"source_host"`
+	SourcePort                   int                 `json:"source_port"`
+	SourceUsername               string              `json:"source_username"`
+	SourcePassword               string              `json:"source_password"`
+	SourceDbName                 string              `json:"source_db_name"`
+	SourceInstance               string              `json:"source_instance"`
+	SourceAuthentication         string              `json:"source_authentication"`
+	SourceDomain                 string              `json:"source_domain"`
+	SourceTenantId               string              `json:"source_tenant_id"`
+	SourceClientId               string              `json:"source_client_id"`
+	SourceEncrypt                string              `json:"source_encrypt"`
+	SourceTrustServerCertificate *bool               `json:"source_trust_server_certificate"`
+	SourceCertificate            string              `json:"source_certificate"`
+	SourceHostNameInCertificate  string              `json:"source_host_name_in_certificate"`
+	SourceApplicationIntent      string              `json:"source_application_intent"`
+	SourceMultiSubnetFailover    bool                `json:"source_multi_subnet_failover"`
+	SourceConnectionTimeout      int                 `json:"source_connection_timeout"`
+	SourceDialTimeout            int                 `json:"source_dial_timeout"`
+	TargetAccountId              string              `json:"target_account_id"`
+	TargetUsername               string              `json:"target_username"`
+	TargetPrivateKeyLocation     string              `json:"target_private_key_location"`
+	TargetRole                   string              `json:"target_role"`
+	TargetWarehouse              string              `json:"target_warehouse"`
+	TargetAwsRegion              string              `json:"target_aws_region"`
+	TargetDbName                 string              `json:"target_db_name"`
+	TargetStorageIntegration     string              `json:"target_storage_integration"`
+	TargetDivisionCode           string              `json:"target_division_code"`
+	TargetRootName               string              `json:"target_root_name"`
+	TargetFileFormatName         string              `json:"target_file_format_name"`
+	Concurrency                  int                 `json:"concurrency"`
+	ChunkSize                    int                 `json:"chunk_size"`
+	IncludeTables                []string            `json:"include_tables"`
+	ExcludeTables                []string            `json:"exclude_tables"`
+	Tables                       []data.TableOptions `json:"tables"`
+	DiscoverTables               *bool               `json:"discover_tables"`
+	SplitTablesOverMB            int64               `json:"split_tables_over_mb"`
+	SplitRanges                  int                 `json:"split_ranges"`
+	Consistency                  string              `json:"consistency"`
+	OnRowCountMismatch           string              `json:"on_row_count_mismatch"`
+	Views                        string              `json:"views"`
+	ValidateChecksums            bool                `json:"validate_checksums"`
+	Sample                       *data.Sample        `json:"sample"`
+	TemporalPeriodColumns        bool                `json:"temporal_period_columns"`
+	ComputedColumns              string              `json:"computed_columns"`
+	Queries                      []struct {
+		TargetTable string `json:"target_table"`
+		SourceQuery string `json:"source_query"`
+	} `json:"queries"`
+	// ServerName               string `json:"server_name"`
+}
 
+// toConfig maps the request body onto the transfer's configuration,
+// recording any validation failures in v.
+func (input transferInput) toConfig(v *validator.Validator) (data.AwsConfig, data.Source, data.Target) {
 	awsConfig := data.AwsConfig{
 		S3Bucket:  input.AwsConfigS3Bucket,
 		S3Dir:     input.AwsConfigS3Dir,
@@ -89,11 +112,25 @@ func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	source := data.Source{
-		Host:     input.SourceHost,
-		Port:     input.SourcePort,
-		Username: input.SourceUsername,
-		Password: input.SourcePassword,
-		DbName:   input.SourceDbName,
+		Type:                   input.SourceType,
+		Host:                   input.SourceHost,
+		Port:                   input.SourcePort,
+		Username:               input.SourceUsername,
+		Password:               input.SourcePassword,
+		DbName:                 input.SourceDbName,
+		Instance:               input.SourceInstance,
+		Authentication:         input.SourceAuthentication,
+		Domain:                 input.SourceDomain,
+		TenantId:               input.SourceTenantId,
+		ClientId:               input.SourceClientId,
+		Encrypt:                input.SourceEncrypt,
+		TrustServerCertificate: input.SourceTrustServerCertificate,
+		Certificate:            input.SourceCertificate,
+		HostNameInCertificate:  input.SourceHostNameInCertificate,
+		ApplicationIntent:      input.SourceApplicationIntent,
+		MultiSubnetFailover:    input.SourceMultiSubnetFailover,
+		ConnectionTimeout:      input.SourceConnectionTimeout,
+		DialTimeout:            input.SourceDialTimeout,
 	}
 
 	// remove .NA.PACCAR.COM from servername
@@ -117,77 +154,164 @@ func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Req
 	data.ValidateAwsConfig(v, awsConfig)
 	data.ValidateSource(v, source)
 	data.ValidateTarget(v, target)
+	data.ValidateTableFilter(v, input.tableFilter())
+	data.ValidateTableOptions(v, input.Tables)
+	v.Check(validator.PermittedValue(input.Consistency, "", data.ConsistencyNone, data.ConsistencySnapshot), "consistency", "must be none or snapshot")
+	v.Check(validator.PermittedValue(input.OnRowCountMismatch, "", data.RowCountMismatchFail, data.RowCountMismatchWarn), "on_row_count_mismatch", "must be fail or warn")
+	v.Check(input.SplitTablesOverMB >= 0, "split_tables_over_mb", "must not be negative")
+	v.Check(input.SplitRanges >= 0 && input.SplitRanges <= 1000, "split_ranges", "must be between 0 and 1000")
+	v.Check(validator.PermittedValue(input.Views, "", data.ViewsMaterialize, data.ViewsTranslate), "views", "must be materialize or translate")
+	v.Check(input.discover() || input.Views == "", "views", "only applies to discovered tables and needs discover_tables")
+	v.Check(input.discover() || len(input.Tables) == 0, "tables", "only applies to discovered tables and needs discover_tables")
+	data.ValidateCustomQueries(v, input.customQueries(), input.discover())
+	if input.ValidateChecksums {
+		// Checksums read each custom query as a derived table.
+		for i, query := range input.customQueries() {
+			v.Check(data.Derivable(query.SourceQuery), fmt.Sprintf("queries[%d].source_query", i), "must not use a CTE or an ORDER BY without TOP when validate_checksums is true")
+		}
+	}
 
-	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+	v.Check(validator.PermittedValue(input.ComputedColumns, "", data.ComputedColumnsValues, data.ComputedColumnsSkip), "computed_columns", "must be values or skip")
+	data.ValidateSample(v, input.Sample)
+	if input.Sample != nil {
+		v.Check(input.discover(), "sample", "only applies to discovered tables and needs discover_tables")
+		v.Check(input.SplitTablesOverMB == 0, "split_tables_over_mb", "cannot be used with sample")
+		for i, opts := range input.Tables {
+			key := fmt.Sprintf("tables[%d]", i)
+			v.Check(opts.Mode == "" || opts.Mode == data.ModeFull, key+".mode", "must be full when sampling")
+			v.Check(opts.Partitions <= 1 && opts.PartitionBy == "", key+".partitions", "cannot be used with sample")
+		}
+	}
+
+	// Snapshots, views, checksums, splitting and the incremental modes read
+	// SQL Server catalogs, so PostgreSQL sources get full reloads only.
+	if source.Type == data.SourceTypePostgresql {
+		v.Check(input.Consistency != data.ConsistencySnapshot, "consistency", "snapshot is not supported for postgresql sources")
+		v.Check(input.Views == "", "views", "is not supported for postgresql sources")
+		v.Check(!input.ValidateChecksums, "validate_checksums", "is not supported for postgresql sources")
+		v.Check(input.Sample == nil, "sample", "is not supported for postgresql sources")
+		v.Check(!input.TemporalPeriodColumns, "temporal_period_columns", "is not supported for postgresql sources")
+		v.Check(input.ComputedColumns == "", "computed_columns", "is not supported for postgresql sources")
+		v.Check(input.SplitTablesOverMB == 0, "split_tables_over_mb", "is not supported for postgresql sources")
+		for i, opts := range input.Tables {
+			key := fmt.Sprintf("tables[%d]", i)
+			v.Check(opts.Mode == "" || opts.Mode == data.ModeFull, key+".mode", "must be full for postgresql sources")
+			v.Check(opts.Partitions <= 1 && opts.PartitionBy == "", key+".partitions", "is not supported for postgresql sources")
+		}
 	}
 
-	query := url.Values{}
-	query.Add("database", source.DbName)
+	return awsConfig, source, target
+}
+
+// showTransferLogsHandler serves the transfer's log buffer, which is restored
+// from the transfer directory after a restart.
+func (app *application) showTransferLogsHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
 
-	u := &url.URL{
-		Scheme:   "sqlserver",
-		User:     url.UserPassword(source.Username, source.Password),
-		Host:     fmt.Sprintf("%s:%d", source.Host, source.Port),
-		RawQuery: query.Encode(),
+	transfer, ok := app.transfers.Get(params.ByName("id"))
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
 	}
-	sourceDsn := u.String()
 
-	sourceDb, err := sql.Open("mssql", sourceDsn)
+	qs := r.URL.Query()
+	v := validator.New()
+
+	level, err := jsonlog.ParseLevel(app.readString(qs, "level", "debug"))
 	if err != nil {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to open source db, err: %v", err))
+		v.AddError("level", "must be one of debug, info, warn, error or fatal")
+	}
+	after := app.readInt(qs, "after", 0, v)
+	tail := app.readInt(qs, "tail", 0, v)
+
+	v.Check(after >= 0, "after", "must not be negative")
+	v.Check(tail >= 0, "tail", "must not be negative")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	source.Db = sourceDb
+	env := envelope{
+		"transfer_id":     transfer.Id,
+		"transfer_status": transfer.Status,
+		"logs":            transfer.Logs.Entries(level, int64(after), tail),
+		"dropped":         transfer.Logs.Dropped(),
+	}
 
-	priv, err := ioutil.ReadFile(target.PrivateKeyLocation)
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to read private key file, err: %v", err))
-		return
+		app.errorResponse(w, r, http.StatusInternalServerError, err)
 	}
-	privPem, _ := pem.Decode(priv)
-	if len(privPem.Bytes) == 0 {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to read private key pem bytes, err: %v", err))
-		return
+}
+
+func (input transferInput) tableFilter() data.TableFilter {
+	return data.TableFilter{
+		Include: input.IncludeTables,
+		Exclude: input.ExcludeTables,
 	}
-	privPemBytes := privPem.Bytes
-	var parsedKey interface{}
-	if parsedKey, err = x509.ParsePKCS1PrivateKey(privPemBytes); err != nil {
-		if parsedKey, err = x509.ParsePKCS8PrivateKey(privPemBytes); err != nil {
-			app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to parse private key pem bytes, err: %v", err))
-			return
-		}
+}
+
+func (input transferInput) customQueries() []data.Query {
+	queries := make([]data.Query, 0, len(input.Queries))
+	for _, query := range input.Queries {
+		queries = append(queries, data.Query{
+			TargetTable: query.TargetTable,
+			SourceQuery: query.SourceQuery,
+		})
 	}
-	privKey, ok := parsedKey.(*rsa.PrivateKey)
-	if !ok {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to assert privkey to *rsa.PrivateKey, err: %v", err))
+	return queries
+}
+
+// discover reports whether the catalog should be read. It defaults to true
+// unless the request only lists custom queries.
+func (input transferInput) discover() bool {
+	if input.DiscoverTables != nil {
+		return *input.DiscoverTables
+	}
+	return len(input.Queries) == 0
+}
+
+func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Request) {
+	var input transferInput
+
+	ctx, span := tracer.Start(r.Context(), "createTransferHandler")
+	defer span.End()
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to read JSON, err: %v", err))
 		return
 	}
 
-	target.PrivateKey = *privKey
+	v := validator.New()
 
-	snowflakeConfig := gosnowflake.Config{
-		Account:       target.AccountId,
-		User:          target.Username,
-		Database:      target.DbName,
-		Warehouse:     target.Warehouse,
-		Role:          target.Role,
-		Authenticator: gosnowflake.AuthTypeJwt,
-		PrivateKey:    &target.PrivateKey,
-		// Schema:        "sqlpipe",
+	awsConfig, source, target := input.toConfig(v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sourceDb, err := source.Open()
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	targetDsn, err := gosnowflake.DSN(&snowflakeConfig)
+	source.Db = sourceDb
+
+	privKey, err := data.ReadPrivateKey(target.PrivateKeyLocation)
 	if err != nil {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to construct a snowflake DSN, err: %v", err))
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	targetDb, err := sql.Open("snowflake", targetDsn)
+	target.PrivateKey = *privKey
+
+	targetDb, err := target.Open("")
 	if err != nil {
-		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("unable to open a connection to snowflake, err: %v", err))
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -204,16 +328,32 @@ func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	transfer := data.Transfer{
-		Id:          transferId,
-		CreatedAt:   time.Now(),
-		Source:      &source,
-		Target:      &target,
-		AwsConfig:   awsConfig,
-		Status:      "running",
-		Concurrency: input.Concurrency,
-	}
-
-	app.transferMap[transferId] = transfer
+		Id:                 transferId,
+		CreatedAt:          time.Now(),
+		Source:             &source,
+		Target:             &target,
+		AwsConfig:          awsConfig,
+		Status:             "running",
+		Concurrency:        input.Concurrency,
+		Filter:             input.tableFilter(),
+		TableOptions:       input.Tables,
+		SplitOverMB:        input.SplitTablesOverMB,
+		SplitRanges:        input.SplitRanges,
+		Consistency:        input.Consistency,
+		OnRowCountMismatch: input.OnRowCountMismatch,
+		Views:              input.Views,
+		ValidateChecksums:  input.ValidateChecksums,
+		Sample:             input.Sample,
+		PeriodColumns:      input.TemporalPeriodColumns,
+		ComputedColumns:    input.ComputedColumns,
+		Discover:           input.discover(),
+		CustomQueries:      input.customQueries(),
+		Logs:               jsonlog.NewBuffer(app.config.transferLogLines, jsonlog.LevelDebug),
+	}
+
+	span.SetAttributes(transferAttributes(transfer)...)
+
+	app.transfers.Insert(transfer)
 
 	headers := make(http.Header)
 
@@ -223,83 +363,161 @@ func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Req
 		"error":       "",
 	}
 
-	app.transferMap[transfer.Id] = transfer
-
 	err = app.writeJSON(w, http.StatusOK, responseMessage, headers)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("error writing json response, err: %v", err))
 		return
 	}
 
+	runCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+
 	app.background(func() {
-		err = app.Run(transfer)
+		err := app.Run(runCtx, transfer)
 		if err != nil {
-			transfer.Status = "failed"
-			transfer.Error = err.Error()
-			app.transferMap[transfer.Id] = transfer
+			app.logger.WithBuffer(transfer.Logs).PrintError(err, map[string]string{
+				"transfer_id": transfer.Id,
+				"phase":       "failed",
+			})
+			app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+				t.Status = "failed"
+				t.Error = err.Error()
+			})
 			return
 		}
 
-		transfer.Status = "complete"
-		app.transferMap[transfer.Id] = transfer
+		app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+			t.Status = "complete"
+		})
 	})
 }
 
-func (app *application) Run(transfer data.Transfer) error {
-	fmt.Println("TEST PRINT")
-	now := time.Now()
-	schemaRows, err := transfer.Source.Db.Query(
-		// "SELECT S.name as schema_name, T.name as table_name FROM sys.tables AS T INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id LEFT JOIN sys.extended_properties AS EP ON EP.major_id = T.[object_id] WHERE T.is_ms_shipped = 0 AND (EP.class_desc IS NULL OR (EP.class_desc <>'OBJECT_OR_COLUMN' AND EP.[name] <> 'microsoft_database_tools_support'))",
-		`SELECT
-		S.name as schema_name,
-		T.name as table_name
-	FROM sys.tables AS T
-	INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id
-	LEFT JOIN sys.extended_properties AS EP ON EP.major_id = T.[object_id]
-	
-	LEFT JOIN sys.indexes i ON T.OBJECT_ID = i.object_id
-	LEFT JOIN sys.partitions p ON i.object_id = p.OBJECT_ID AND i.index_id = p.index_id
-	LEFT JOIN sys.allocation_units a ON p.partition_id = a.container_id
-	
-	WHERE T.is_ms_shipped = 0
-	AND (
-		EP.class_desc IS NULL
-		OR (EP.class_desc <>'OBJECT_OR_COLUMN'AND EP.[name] <> 'microsoft_database_tools_support')
-	)
-	GROUP BY
-		t.Name, s.Name
-	ORDER BY sum(used_pages) DESC`,
-	)
-	if err != nil {
-		return fmt.Errorf("error running query getting all db objects: %v", err)
-	}
-	defer schemaRows.Close()
+func (app *application) Run(ctx context.Context, transfer data.Transfer) (err error) {
+	ctx, span := tracer.Start(ctx, "Run", trace.WithAttributes(transferAttributes(transfer)...))
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	logger := app.logger.WithBuffer(transfer.Logs).With(map[string]string{
+		"transfer_id": transfer.Id,
+		"source_db":   transfer.Source.DbName,
+		"target_db":   transfer.Target.DbName,
+	})
+
+	logger.PrintInfo("starting transfer", map[string]string{"phase": "discover"})
 
-	var sourceSchema string
-	var sourceTable string
+	now := time.Now()
 	queries := []data.Query{}
-	for schemaRows.Next() {
-		err := schemaRows.Scan(&sourceSchema, &sourceTable)
+	views := []data.Query{}
+	skippedTables := []data.SkippedTable{}
+
+	if transfer.Discover {
+		queries, err = app.discoverTables(ctx, transfer)
+		if err != nil {
+			return err
+		}
+
+		if transfer.Views != "" {
+			discoveredViews, err := app.discoverViews(ctx, transfer)
+			if err != nil {
+				return err
+			}
+			queries = append(queries, discoveredViews...)
+		}
+
+		discovered := queries
+		queries, skippedTables, err = transfer.Filter.Apply(queries)
 		if err != nil {
-			return fmt.Errorf("error scanning schema and table into query object: %v", err)
+			return err
 		}
 
-		sourceQuery := fmt.Sprintf("select * from [%v].[%v]", sourceSchema, sourceTable)
+		if transfer.Source.Type != data.SourceTypePostgresql {
+			queries, skippedTables, err = app.applyTableKinds(ctx, transfer, discovered, queries, skippedTables)
+			if err != nil {
+				return err
+			}
+		}
 
-		query := data.Query{
-			Schema:      sourceSchema,
-			Table:       sourceTable,
-			SourceQuery: sourceQuery,
+		// Translated views are created once every table is in place, so
+		// they are not transferred like tables.
+		if transfer.Views == data.ViewsTranslate {
+			tables := []data.Query{}
+			for _, query := range queries {
+				if query.View {
+					views = append(views, query)
+				} else {
+					tables = append(tables, query)
+				}
+			}
+			queries = tables
 		}
 
-		queries = append(queries, query)
+		err = app.applyTableOptions(ctx, transfer, queries, skippedTables)
+		if err != nil {
+			return err
+		}
+
+		if transfer.Sample != nil {
+			err = app.applySample(ctx, transfer, queries)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Split tables over the size threshold that have no partitioning
+		// of their own, defaulting to one range per concurrent read.
+		if transfer.SplitOverMB > 0 {
+			ranges := transfer.SplitRanges
+			if ranges == 0 {
+				ranges = transfer.Concurrency
+			}
+			for i, query := range queries {
+				eligible := query.Mode == "" || query.Mode == data.ModeFull || query.Mode == data.ModeIncremental
+				if eligible && query.SizeMB >= transfer.SplitOverMB && query.Partitions == 0 && query.PartitionBy == "" {
+					queries[i].Partitions = ranges
+					queries[i].AutoSplit = true
+				}
+			}
+		}
+
+		for _, skipped := range skippedTables {
+			logger.PrintDebug("skipping table", map[string]string{
+				"phase":  "discover",
+				"schema": skipped.Schema,
+				"table":  skipped.Table,
+				"reason": skipped.Reason,
+			})
+		}
 	}
-	err = schemaRows.Err()
-	if err != nil {
-		return fmt.Errorf("error iterating over schemaRows: %v", err)
+
+	queries = append(queries, transfer.CustomQueries...)
+
+	// Discovered tables, custom queries and translated views share the prod
+	// schema and the transfer's S3 directory, so their target names must
+	// not collide.
+	s3Dirs := map[string]string{}
+	for _, query := range append(append([]data.Query(nil), queries...), views...) {
+		_, name := query.TargetName()
+		s3Dir := CleanString(name)
+		if other, ok := s3Dirs[s3Dir]; ok {
+			return fmt.Errorf("target table %v collides with %v", name, other)
+		}
+		s3Dirs[s3Dir] = name
 	}
 
-	fmt.Printf("DB :%v, Time to get all db objects: %v\n", transfer.Source.DbName, time.Since(now).String())
+	app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+		t.Queries = append([]data.Query(nil), queries...)
+		t.SkippedTables = skippedTables
+	})
+
+	logger.PrintInfo("discovered source tables", map[string]string{
+		"phase":    "discover",
+		"duration": time.Since(now).String(),
+		"tables":   strconv.Itoa(len(queries)),
+		"custom":   strconv.Itoa(len(transfer.CustomQueries)),
+		"skipped":  strconv.Itoa(len(skippedTables)),
+		"views":    strconv.Itoa(len(views)),
+	})
 	now = time.Now()
 
 	transfer.Target.DbName = strings.ReplaceAll(transfer.Target.DbName, ".NA.PACCAR.COM", "")
@@ -312,17 +530,29 @@ func (app *application) Run(transfer data.Transfer) error {
 
 	// cleanedSourceDbName := data.QuoteIfTrue(transfer.Source.DbName, sourceDbNameHasNonAlnum)
 
+	sourceTypeName := transfer.Source.Driver().Name()
+
+	// Samples go to their own schemas so prod tables are never touched.
+	schemaSuffix := ""
+	if transfer.Sample != nil {
+		schemaSuffix = transfer.Sample.Suffix()
+	}
+
 	draftProdSchemaName := fmt.Sprintf(
-		`%v_MSSQL_%v`,
+		`%v_%v_%v%v`,
 		strings.ToUpper(transfer.Target.DivisionCode),
+		sourceTypeName,
 		strings.ToUpper(transfer.Source.DbName),
+		schemaSuffix,
 	)
 
 	stagingSchemaName := data.QuoteIfTrue(
 		fmt.Sprintf(
-			`%v_MSSQL_%v_STAGING`,
+			`%v_%v_%v%v_STAGING`,
 			strings.ToUpper(transfer.Target.DivisionCode),
+			sourceTypeName,
 			strings.ToUpper(transfer.Source.DbName),
+			schemaSuffix,
 		),
 		sourceDbNameHasNonAlnum,
 	)
@@ -330,94 +560,127 @@ func (app *application) Run(transfer data.Transfer) error {
 	var prodSchemaNameFromSp string
 
 	callSpQuery := fmt.Sprintf(
-		`CALL %v.PUBLIC.SP_GRANT_SCHEMA_ACCESS('MSSQL','%v','%v','%v','SQLpipe');`,
+		`CALL %v.PUBLIC.SP_GRANT_SCHEMA_ACCESS('%v','%v','%v','%v','SQLpipe');`,
 		transfer.Target.DbName,
+		sourceTypeName,
 		transfer.Target.RootName,
 		strings.ToUpper(transfer.Source.DbName),
 		draftProdSchemaName,
 	)
-	err = transfer.Target.Db.QueryRow(callSpQuery).Scan(&prodSchemaNameFromSp)
+	err = queryRowSnowflake(ctx, transfer.Target.Db, callSpQuery, &prodSchemaNameFromSp)
 	if err != nil {
 		return fmt.Errorf("error calling sp_grant_schema_access, query was %v. error was: %v", callSpQuery, err)
 	}
 
-	fmt.Println("prodSchemaNameFromSp: ", prodSchemaNameFromSp)
+	if schemaSuffix != "" && !strings.HasSuffix(strings.ToUpper(strings.Trim(prodSchemaNameFromSp, `"`)), schemaSuffix) {
+		return fmt.Errorf("sp_grant_schema_access returned schema %v, which does not end in %v; refusing to load a sample into it", prodSchemaNameFromSp, schemaSuffix)
+	}
+
+	logger.PrintDebug("resolved prod schema", map[string]string{
+		"phase":       "prepare_target",
+		"prod_schema": prodSchemaNameFromSp,
+	})
 
-	fmt.Printf("DB :%v, Time to run sp_grant_schema_access: %v\n", transfer.Source.DbName, time.Since(now).String())
+	logger.PrintInfo("ran sp_grant_schema_access", map[string]string{
+		"phase":    "prepare_target",
+		"duration": time.Since(now).String(),
+	})
 	now = time.Now()
 
 	dropSchemaQuery := fmt.Sprintf(
 		`drop schema if exists %v`,
 		stagingSchemaName,
 	)
-	_, err = transfer.Target.Db.Exec(
-		dropSchemaQuery,
-	)
+	_, err = execSnowflake(ctx, transfer.Target.Db, dropSchemaQuery)
 	if err != nil {
 		return fmt.Errorf("error running drop schema query, query was %v. error was: %v", dropSchemaQuery, err)
 	}
 
-	fmt.Printf("DB :%v, Time to drop staging schema: %v\n", transfer.Source.DbName, time.Since(now).String())
+	logger.PrintInfo("dropped staging schema", map[string]string{
+		"phase":    "prepare_target",
+		"duration": time.Since(now).String(),
+	})
 	now = time.Now()
 
 	createSchemaQuery := fmt.Sprintf(
 		`create schema if not exists %v`,
 		stagingSchemaName,
 	)
-	_, err = transfer.Target.Db.Exec(
-		createSchemaQuery,
-	)
+	_, err = execSnowflake(ctx, transfer.Target.Db, createSchemaQuery)
 	if err != nil {
 		return fmt.Errorf("error running create schema query, query was %v. error was: %v", createSchemaQuery, err)
 	}
 
-	fmt.Printf("DB :%v, Time to create staging schema: %v\n", transfer.Source.DbName, time.Since(now).String())
+	logger.PrintInfo("created staging schema", map[string]string{
+		"phase":    "prepare_target",
+		"duration": time.Since(now).String(),
+	})
 	now = time.Now()
 
-	snowflakeConfig := gosnowflake.Config{
-		Account:       transfer.Target.AccountId,
-		User:          transfer.Target.Username,
-		Database:      transfer.Target.DbName,
-		Warehouse:     transfer.Target.Warehouse,
-		Role:          transfer.Target.Role,
-		Authenticator: gosnowflake.AuthTypeJwt,
-		PrivateKey:    &transfer.Target.PrivateKey,
-		Schema:        stagingSchemaName,
-	}
-
-	targetDsn, err := gosnowflake.DSN(&snowflakeConfig)
-	if err != nil {
-		return fmt.Errorf("error creating snowflake dsn: %v", err)
-	}
-
-	targetDb, err := sql.Open("snowflake", targetDsn)
+	targetDb, err := transfer.Target.Open(stagingSchemaName)
 	if err != nil {
 		return fmt.Errorf("error opening snowflake connection: %v", err)
 	}
 
 	// ping targetDb
-	err = targetDb.Ping()
+	err = targetDb.PingContext(ctx)
 	if err != nil {
 		return fmt.Errorf("error pinging snowflake connection: %v", err)
 	}
 
-	fmt.Printf("DB :%v, Time to create snowflake connection: %v\n", transfer.Source.DbName, time.Since(now).String())
+	logger.PrintInfo("opened snowflake connection", map[string]string{
+		"phase":    "prepare_target",
+		"duration": time.Since(now).String(),
+	})
 	now = time.Now()
 
-	// create sqlpipe_csv file format in targetDb
-	createFileFormatQuery := `CREATE OR REPLACE FILE FORMAT SQLPIPE_CSV ESCAPE_UNENCLOSED_FIELD = 'NONE' FIELD_OPTIONALLY_ENCLOSED_BY = '\"' COMPRESSION = NONE;`
-	_, err = targetDb.Exec(
-		createFileFormatQuery,
-	)
+	// create sqlpipe_csv file format in targetDb. Only an empty unenclosed
+	// field is NULL, as data.AppendCsvRecord encloses every other value.
+	createFileFormatQuery := `CREATE OR REPLACE FILE FORMAT SQLPIPE_CSV ESCAPE_UNENCLOSED_FIELD = 'NONE' FIELD_OPTIONALLY_ENCLOSED_BY = '\"' EMPTY_FIELD_AS_NULL = TRUE NULL_IF = () COMPRESSION = NONE;`
+	_, err = execSnowflake(ctx, targetDb, createFileFormatQuery)
 	if err != nil {
 		return fmt.Errorf("error running create file format query, query was %v. error was: %v", createFileFormatQuery, err)
 	}
 
-	fmt.Printf("DB :%v, Time to create file format: %v\n", transfer.Source.DbName, time.Since(now).String())
+	logger.PrintInfo("created file format", map[string]string{
+		"phase":    "prepare_target",
+		"duration": time.Since(now).String(),
+	})
+
+	for _, query := range transfer.Queries {
+		if query.Mode == data.ModeIncremental || query.Mode == data.ModeChangeTracking || query.Mode == data.ModeCdc {
+			err = app.createStateTable(ctx, targetDb, transfer)
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	logger.PrintInfo("starting table transfers", map[string]string{
+		"phase":       "transfer_tables",
+		"concurrency": strconv.Itoa(transfer.Concurrency),
+	})
+
+	transfer.SourceReader = transfer.Source.Db
+	sourceReads := transfer.Concurrency
+
+	if transfer.Consistency == data.ConsistencySnapshot {
+		tx, err := app.beginSnapshot(ctx, transfer)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		transfer.SourceReader = tx
+		sourceReads = 1
 
-	fmt.Printf("DB :%v, Now (%v) starting errgroup with concurrency %v\n", transfer.Source.DbName, now.Format(time.RFC3339), transfer.Concurrency)
+		logger.PrintInfo("reading tables from a common snapshot, one at a time", map[string]string{"phase": "transfer_tables"})
+	}
 
-	g, errGroupContext := errgroup.WithContext(context.Background())
+	transfer.SourceReads = semaphore.NewWeighted(int64(sourceReads))
+
+	g, errGroupContext := errgroup.WithContext(ctx)
 	g.SetLimit(transfer.Concurrency)
 	for queryIndex, table := range transfer.Queries {
 
@@ -429,236 +692,43 @@ func (app *application) Run(transfer data.Transfer) error {
 			case <-errGroupContext.Done():
 				return errGroupContext.Err()
 			default:
-				fmt.Printf("DB :%v, Now (%v) starting transfer of %v.%v\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-				transferRows, err := transfer.Source.Db.Query(table.SourceQuery)
-				if err != nil {
-					return fmt.Errorf("error running extraction query: %v", err)
-				}
-
-				columnInfo := data.ColumnInfo{
-					ColumnNames:         []string{},
-					ColumnDbTypes:       []string{},
-					ColumnScanTypes:     []reflect.Type{},
-					ColumnNamesAndTypes: []string{},
-					ColumnPrecisions:    []int64{},
-					ColumnScales:        []int64{},
-					ColumnLengths:       []int64{},
-				}
-
-				colTypesFromDriver, err := transferRows.ColumnTypes()
-				if err != nil {
-					return fmt.Errorf("error getting column types: %v", err)
-				}
-
-				for _, colType := range colTypesFromDriver {
-					columnInfo.ColumnNames = append(columnInfo.ColumnNames, colType.Name())
-					columnInfo.ColumnDbTypes = append(columnInfo.ColumnDbTypes, colType.DatabaseTypeName())
-					columnInfo.ColumnScanTypes = append(columnInfo.ColumnScanTypes, colType.ScanType())
-
-					colLen, _ := colType.Length()
-					columnInfo.ColumnLengths = append(columnInfo.ColumnLengths, colLen)
-
-					precision, scale, _ := colType.DecimalSize()
-					columnInfo.ColumnPrecisions = append(columnInfo.ColumnPrecisions, precision)
-					columnInfo.ColumnScales = append(columnInfo.ColumnScales, scale)
-				}
-
-				columnInfo.NumCols = len(columnInfo.ColumnNames)
-
-				fmt.Printf("DB :%v, Now (%v) getting create table types for %v.%v\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-				columnInfo, err = data.GetCreateTableTypes(columnInfo)
-				if err != nil {
-					return fmt.Errorf("error getting create table types: %v", err)
-				}
-
-				table.Schema = strings.ReplaceAll(strings.ToUpper(table.Schema), " ", "_")
-				table.Table = strings.ReplaceAll(strings.ToUpper(table.Table), " ", "_")
-
-				sourceSchemaNameHasNonAlnum := data.HasNonAlnumOrSpace(table.Schema)
-				sourceTableNameHasNonAlnum := data.HasNonAlnumOrSpace(table.Table)
-
-				eitherHasNonAlnum := false
-
-				if sourceSchemaNameHasNonAlnum || sourceTableNameHasNonAlnum {
-					eitherHasNonAlnum = true
-				}
-
-				cleanedTableName := data.QuoteIfTrue(
-					fmt.Sprintf(
-						`%v_%v`,
-						table.Schema,
-						table.Table,
-					),
-					eitherHasNonAlnum,
-				)
-
-				s3DirName := CleanString(
-					fmt.Sprintf("%v_%v",
-						table.Schema,
-						table.Table,
-					),
-				)
-
-				createTablequery := fmt.Sprintf(
-					`create table if not exists %v.%v (`,
-					stagingSchemaName,
-					cleanedTableName,
-				)
-
-				for _, colNameAndType := range columnInfo.ColumnNamesAndTypes {
-					createTablequery = createTablequery + fmt.Sprintf("%v, ", colNameAndType)
-				}
-
-				createTablequery = strings.TrimSuffix(createTablequery, ", ")
-				createTablequery = createTablequery + ");"
-				transfer.Queries[queryIndex].TargetCreateTableQuery = createTablequery
-
-				fmt.Printf("DB :%v, Now (%v) creating table %v.%v\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), stagingSchemaName, cleanedTableName)
-
-				_, err = targetDb.Exec(
-					createTablequery,
-				)
-				if err != nil {
-					return fmt.Errorf("error running create table query, query was %v. error was: %v", createTablequery, err)
-				}
-
-				numCols := columnInfo.NumCols
-
-				var stringBuilder strings.Builder
-				csvWriter := csv.NewWriter(&stringBuilder)
-
-				colDbTypes := columnInfo.ColumnDbTypes
-				vals := make([]interface{}, numCols)
-				valPtrs := make([]interface{}, numCols)
-				dataInRam := false
-
-				for i := 0; i < numCols; i++ {
-					valPtrs[i] = &vals[i]
-				}
-
-				fmt.Printf("DB :%v, Now (%v) starting transfer of %v.%v\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-
-				rowVals := make([]string, numCols)
-				for i := 1; transferRows.Next(); i++ {
-					transferRows.Scan(valPtrs...)
-					for j := 0; j < numCols; j++ {
-						formatter, ok := data.Formatters[colDbTypes[j]]
-						if !ok {
-							return fmt.Errorf("no formatter for db type %v", colDbTypes[j])
-						}
-						rowVals[j], err = formatter(vals[j])
-						if err != nil {
-							return fmt.Errorf("error formatting values for csv file: %v", err)
-						}
-					}
-					err = csvWriter.Write(rowVals)
-					if err != nil {
-						return fmt.Errorf("error writing values to csv file: %v", err)
-					}
-
-					dataInRam = true
-
-					if data.TurboInsertChecker(stringBuilder.Len(), transfer.AwsConfig.ChunkSize) {
-						fmt.Printf("DB :%v, Now (%v) uploading and transferring %v.%v\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-						csvWriter.Flush()
-						// reader, err := data.GetGzipReader(stringBuilder.String())
-						// if err != nil {
-						// 	return fmt.Errorf("error getting gzip reader: %v", err)
-						// }
-
-						go data.UploadAndTransfer(stringBuilder.String(), app.uploader, s3DirName, transfer.Id, transfer.AwsConfig.S3Dir, transfer.AwsConfig.S3Bucket)
-						// if err != nil {
-						// 	return fmt.Errorf("error running upload and transfer: %v", err)
-						// }
-						dataInRam = false
-						stringBuilder.Reset()
-					}
-				}
-
-				if dataInRam {
-					fmt.Printf("DB :%v, Now (%v) starting final upload and transfer of %v.%v\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-					csvWriter.Flush()
-					// reader, err := data.GetGzipReader(stringBuilder.String())
-					// if err != nil {
-					// 	return fmt.Errorf("error getting gzip reader: %v", err)
-					// }
-					err = data.UploadAndTransfer(stringBuilder.String(), app.uploader, s3DirName, transfer.Id, transfer.AwsConfig.S3Dir, transfer.AwsConfig.S3Bucket)
-					if err != nil {
-						return fmt.Errorf("error running upload and transfer: %v", err)
-					}
-				}
-
-				fmt.Printf("DB :%v, Now (%v) finished upload of %v.%v, starting s3 copy\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-
-				loadingQuery := fmt.Sprintf(
-					`copy into %v.%v from s3://%v/%v STORAGE_INTEGRATION = "%v" file_format = (format_name = SQLPIPE_CSV)`,
-					stagingSchemaName,
-					cleanedTableName,
-					transfer.AwsConfig.S3Bucket,
-					fmt.Sprintf("%v/%v/%v/", transfer.AwsConfig.S3Dir, transfer.Id, s3DirName),
-					transfer.Target.StorageIntegration,
-					// transfer.Target.FileFormatName,
-				)
-				_, err = targetDb.Exec(loadingQuery)
-				if err != nil {
-					return fmt.Errorf("error running copy command, query was %v, error was %v", loadingQuery, err)
-				}
-
-				fmt.Printf("DB :%v, Now (%v) finished s3 copy of %v.%v, starting deletion of table in prod schema\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-
-				dropTableInProdQuery := fmt.Sprintf(
-					`drop table if exists %v.%v.%v;`,
-					transfer.Target.DbName,
-					prodSchemaNameFromSp,
-					cleanedTableName,
-				)
-				_, err = targetDb.Exec(dropTableInProdQuery)
-				if err != nil {
-					return fmt.Errorf("error running command to drop table in prod schema, query was %v, error was %v", dropTableInProdQuery, err)
-				}
-
-				fmt.Printf("DB :%v, Now (%v) finished dropping table in prod schema of %v.%v, starting move staging to prod schema\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-
-				moveTableFromStagingToProdSchema := fmt.Sprintf(
-					`alter table %v.%v.%v rename to %v.%v.%v;`,
-					transfer.Target.DbName,
-					stagingSchemaName,
-					cleanedTableName,
-					transfer.Target.DbName,
-					prodSchemaNameFromSp,
-					cleanedTableName,
-				)
-				_, err = targetDb.Exec(moveTableFromStagingToProdSchema)
-				if err != nil {
-					return fmt.Errorf("error running command to move table from staging to prod schema, query was %v, error was %v", moveTableFromStagingToProdSchema, err)
-				}
-
-				fmt.Printf("DB :%v, Now (%v) finished moving table from staging to prod schema of %v.%v\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), table.Schema, table.Table)
-
-				return nil
+				return app.transferTable(errGroupContext, logger, transfer, targetDb, stagingSchemaName, prodSchemaNameFromSp, queryIndex, table)
 			}
 		})
 	}
 
-	fmt.Printf("DB :%v, Now (%v) waiting for all queries of db %v to finish\n", transfer.Source.DbName, time.Now().Format(time.RFC3339), transfer.Source.DbName)
+	logger.PrintDebug("waiting for table transfers to finish", map[string]string{"phase": "transfer_tables"})
 
 	errGroupError := g.Wait()
 	if errGroupError != nil {
+		logger.PrintWarn("table transfer failed", map[string]string{
+			"phase": "transfer_tables",
+			"error": errGroupError.Error(),
+		})
 		return fmt.Errorf("error running transfer queries: %v", errGroupError)
 	}
 
-	fmt.Printf("DB :%v, Now (%v) finished all queries\n", transfer.Source.DbName, time.Now().Format(time.RFC3339))
+	if transfer.Discover && transfer.Source.Type != data.SourceTypePostgresql {
+		app.replicateConstraints(ctx, logger, transfer, targetDb, prodSchemaNameFromSp)
+		app.copyDescriptions(ctx, logger, transfer, targetDb, prodSchemaNameFromSp)
+	}
+
+	if len(views) > 0 {
+		app.translateViews(ctx, logger, transfer, targetDb, prodSchemaNameFromSp, views)
+	}
+
+	logger.PrintInfo("finished all tables, dropping staging schema", map[string]string{"phase": "cleanup"})
 
 	dropStagingSchemaQuery := fmt.Sprintf(
 		`drop schema if exists %v;`,
 		stagingSchemaName,
 	)
-	_, err = targetDb.Exec(dropStagingSchemaQuery)
+	_, err = execSnowflake(ctx, targetDb, dropStagingSchemaQuery)
 	if err != nil {
 		return fmt.Errorf("error running drop staging schema query, query was %v, error was %v", dropStagingSchemaQuery, err)
 	}
 
-	fmt.Printf("DB :%v, Now (%v) is donezo\n", transfer.Source.DbName, time.Now().Format(time.RFC3339))
+	logger.PrintInfo("finished transfer", map[string]string{"phase": "cleanup"})
 
 	return nil
 }
@@ -674,3 +744,11 @@ func CleanString(input string) string {
 
 	return sb.String()
 }
+
+// auxiliaryS3DirName names the S3 directory of a table staged alongside
+// tableName, such as its change tracking deletes or its CDC changes.
+// CleanString never leaves an underscore, so a prefixed name cannot collide
+// with the S3 directory of another table.
+func auxiliaryS3DirName(prefix, tableName string) string {
+	return prefix + "_" + CleanString(tableName)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+// validateChecksums compares aggregate fingerprints of sourceQuery with those
+// of the staging table it was loaded into and records the result on the
+// query's status. Mismatches are reported, not fatal. Outside snapshot
+// consistency, writes to the source during the run can cause false alarms.
+func (app *application) validateChecksums(
+	ctx context.Context,
+	tableLogger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	cleanedTableName string,
+	queryIndex int,
+	sourceQuery string,
+	columnInfo data.ColumnInfo,
+) {
+	validation := app.compareChecksums(ctx, transfer, targetDb, stagingSchemaName, cleanedTableName, sourceQuery, columnInfo)
+
+	switch {
+	case validation.Error != "":
+		tableLogger.PrintWarn("could not validate checksums", map[string]string{
+			"phase": "validate",
+			"error": validation.Error,
+		})
+	case validation.Mismatches > 0:
+		for _, column := range validation.Columns {
+			if column.Match {
+				continue
+			}
+			tableLogger.PrintWarn("checksum mismatch", map[string]string{
+				"phase":  "validate",
+				"column": column.Column,
+				"check":  column.Check,
+				"source": column.Source,
+				"target": column.Target,
+			})
+		}
+	default:
+		tableLogger.PrintInfo("checksums match", map[string]string{
+			"phase":  "validate",
+			"checks": strconv.Itoa(len(validation.Columns)),
+		})
+	}
+
+	app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+		if queryIndex < len(t.Queries) {
+			t.Queries[queryIndex].Validation = &validation
+		}
+	})
+}
+
+func (app *application) compareChecksums(
+	ctx context.Context,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	stagingSchemaName string,
+	cleanedTableName string,
+	sourceQuery string,
+	columnInfo data.ColumnInfo,
+) data.TableValidation {
+	fingerprints, skipped := data.Fingerprints(columnInfo)
+
+	failed := func(err error) data.TableValidation {
+		return data.TableValidation{Status: "error", Skipped: skipped, Error: err.Error()}
+	}
+
+	sourceValues := make([]sql.NullString, len(fingerprints))
+	sourceDest := make([]interface{}, len(fingerprints))
+	for i := range sourceValues {
+		sourceDest[i] = &sourceValues[i]
+	}
+
+	sourceFingerprintQuery := data.SourceFingerprintQuery(fingerprints, sourceQuery)
+	err := scanSourceRow(ctx, transfer, sourceFingerprintQuery, nil, sourceDest...)
+	if err != nil {
+		return failed(fmt.Errorf("error computing source checksums, query was %v, error was %v", sourceFingerprintQuery, err))
+	}
+
+	targetValues := make([]sql.NullString, len(fingerprints))
+	targetDest := make([]interface{}, len(fingerprints))
+	for i := range targetValues {
+		targetDest[i] = &targetValues[i]
+	}
+
+	targetFingerprintQuery := data.TargetFingerprintQuery(
+		fingerprints,
+		fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, stagingSchemaName, cleanedTableName),
+	)
+	err = queryRowSnowflake(ctx, targetDb, targetFingerprintQuery, targetDest...)
+	if err != nil {
+		return failed(fmt.Errorf("error computing target checksums, query was %v, error was %v", targetFingerprintQuery, err))
+	}
+
+	return data.CompareFingerprints(fingerprints, skipped, sourceValues, targetValues)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/data"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+// translateViews creates a Snowflake view in the prod schema for each source
+// view whose definition can be translated, over the tables this transfer
+// replicated. Views that depend on other views are retried until no more
+// can be created. Failures are reported on the transfer, not returned.
+func (app *application) translateViews(
+	ctx context.Context,
+	logger *jsonlog.Logger,
+	transfer data.Transfer,
+	targetDb *sql.DB,
+	prodSchemaName string,
+	views []data.Query,
+) {
+	targets := map[string]string{}
+	for _, query := range append(append([]data.Query(nil), transfer.Queries...), views...) {
+		if query.Schema == "" {
+			continue
+		}
+		cleanedName, _ := query.TargetName()
+		targets[strings.ToLower(query.Schema+"."+query.Table)] = fmt.Sprintf("%v.%v.%v", transfer.Target.DbName, prodSchemaName, cleanedName)
+	}
+	resolve := func(schema, name string) (string, bool) {
+		target, ok := targets[strings.ToLower(schema+"."+name)]
+		return target, ok
+	}
+
+	reports := make([]data.ViewReport, len(views))
+	pending := []int{}
+
+	for i, view := range views {
+		_, targetName := view.TargetName()
+		reports[i] = data.ViewReport{Schema: view.Schema, View: view.Table, TargetView: targetName}
+
+		if view.ViewDefinition == "" {
+			reports[i].Status = data.ViewUntranslatable
+			reports[i].Reason = "definition is encrypted or not visible"
+			continue
+		}
+
+		columns, query, err := data.TranslateView(view.ViewDefinition, transfer.Source.DbName, view.Schema, resolve)
+		if err != nil {
+			reports[i].Status = data.ViewUntranslatable
+			reports[i].Reason = err.Error()
+			continue
+		}
+
+		columnList := ""
+		if len(columns) > 0 {
+			columnList = fmt.Sprintf(" (%v)", strings.Join(columns, ", "))
+		}
+		reports[i].TargetQuery = fmt.Sprintf("create or replace view %v%v as\n%v", targets[strings.ToLower(view.Schema+"."+view.Table)], columnList, query)
+		pending = append(pending, i)
+	}
+
+	for len(pending) > 0 {
+		failed := []int{}
+		for _, i := range pending {
+			_, err := execSnowflake(ctx, targetDb, reports[i].TargetQuery)
+			if err != nil {
+				reports[i].Status = data.ViewFailed
+				reports[i].Reason = err.Error()
+				failed = append(failed, i)
+				continue
+			}
+			reports[i].Status = data.ViewCreated
+			reports[i].Reason = ""
+		}
+		if len(failed) == len(pending) {
+			break
+		}
+		pending = failed
+	}
+
+	created := 0
+	for _, report := range reports {
+		if report.Status == data.ViewCreated {
+			created++
+			continue
+		}
+		logger.PrintWarn("could not create view", map[string]string{
+			"phase":  "views",
+			"schema": report.Schema,
+			"view":   report.View,
+			"status": report.Status,
+			"reason": report.Reason,
+		})
+	}
+
+	logger.PrintInfo("translated views", map[string]string{
+		"phase":   "views",
+		"created": strconv.Itoa(created),
+		"failed":  strconv.Itoa(len(reports) - created),
+	})
+
+	app.transfers.Update(transfer.Id, func(t *data.Transfer) {
+		t.TranslatedViews = reports
+	})
+}
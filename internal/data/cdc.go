@@ -0,0 +1,56 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var lsnRX = regexp.MustCompile(`^0x[0-9A-Fa-f]{20}$`)
+
+// Columns added to every change row, ahead of the captured columns. LSNs are
+// kept as fixed width hex so they sort the same way as in SQL Server.
+const (
+	CdcLsnColumn       = "SQLPIPE_LSN"
+	CdcSeqvalColumn    = "SQLPIPE_SEQVAL"
+	CdcOperationColumn = "SQLPIPE_OPERATION"
+)
+
+// CdcOperationDelete is the __$operation code of a deleted row. Inserts are 2
+// and updates, which the 'all' row filter only returns after images for, 4.
+const CdcOperationDelete = 1
+
+func ValidLsn(lsn string) bool {
+	return lsnRX.MatchString(lsn)
+}
+
+// CdcChangesQuery selects the changes of captureInstance between two LSNs,
+// inclusive. When afterFrom is set, fromLsn is the last LSN already read and
+// the range starts just past it.
+func CdcChangesQuery(captureInstance string, columns []string, fromLsn, toLsn string, afterFrom bool) (string, error) {
+	if !ValidLsn(fromLsn) || !ValidLsn(toLsn) {
+		return "", fmt.Errorf("invalid lsn range %q to %q", fromLsn, toLsn)
+	}
+
+	from := fromLsn
+	if afterFrom {
+		from = fmt.Sprintf("sys.fn_cdc_increment_lsn(%v)", fromLsn)
+	}
+
+	projection := []string{
+		fmt.Sprintf("convert(varchar(22), __$start_lsn, 1) as %v", CdcLsnColumn),
+		fmt.Sprintf("convert(varchar(22), __$seqval, 1) as %v", CdcSeqvalColumn),
+		fmt.Sprintf("__$operation as %v", CdcOperationColumn),
+	}
+	for _, column := range columns {
+		projection = append(projection, QuoteMssqlIdentifier(column))
+	}
+
+	return fmt.Sprintf(
+		"select %v from cdc.%v(%v, %v, N'all')",
+		strings.Join(projection, ", "),
+		QuoteMssqlIdentifier("fn_cdc_get_all_changes_"+captureInstance),
+		from,
+		toLsn,
+	), nil
+}
@@ -0,0 +1,25 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Description is the MS_Description extended property of a source table or
+// view, or of one of its columns when Column is set.
+type Description struct {
+	Schema string
+	Table  string
+	Column string
+	Text   string
+}
+
+// CommentQuery sets the description as the comment of table, or of its
+// column, in Snowflake.
+func (d Description) CommentQuery(table string) string {
+	text := "'" + strings.ReplaceAll(strings.ReplaceAll(d.Text, `\`, `\\`), "'", "''") + "'"
+	if d.Column == "" {
+		return fmt.Sprintf("comment on table %v is %v", table, text)
+	}
+	return fmt.Sprintf("comment on column %v.%v is %v", table, SnowflakeColumnName(d.Column), text)
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ConstraintPrimaryKey = "PRIMARY KEY"
+	ConstraintUnique     = "UNIQUE"
+	ConstraintForeignKey = "FOREIGN KEY"
+)
+
+const (
+	ConstraintCreated = "created"
+	ConstraintExists  = "exists"
+	ConstraintSkipped = "skipped"
+	ConstraintFailed  = "failed"
+)
+
+// Constraint is a primary key, unique or foreign key constraint of a source
+// table. RefSchema, RefTable and RefColumns are set for foreign keys only.
+type Constraint struct {
+	Schema     string
+	Table      string
+	Name       string
+	Type       string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+}
+
+// ConstraintReport records what happened to one source constraint.
+type ConstraintReport struct {
+	Schema      string `json:"schema"`
+	Table       string `json:"table"`
+	Constraint  string `json:"constraint"`
+	Type        string `json:"type"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	TargetQuery string `json:"target_query,omitempty"`
+}
+
+// TargetName returns the name the constraint gets in Snowflake.
+func (c Constraint) TargetName() string {
+	return SnowflakeColumnName(c.Name)
+}
+
+// AddConstraintQuery adds c to table, whose columns are named as Snowflake
+// names the source columns. refTable is the table a foreign key references.
+// Snowflake records but does not enforce these constraints.
+func (c Constraint) AddConstraintQuery(table, refTable string) string {
+	query := fmt.Sprintf(
+		"alter table %v add constraint %v %v (%v)",
+		table,
+		c.TargetName(),
+		c.Type,
+		snowflakeColumnList(c.Columns),
+	)
+	if c.Type == ConstraintForeignKey {
+		query = fmt.Sprintf("%v references %v (%v)", query, refTable, snowflakeColumnList(c.RefColumns))
+	}
+	return query
+}
+
+func snowflakeColumnList(columns []string) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = SnowflakeColumnName(column)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,22 @@
+package data
+
+import "strings"
+
+// AppendCsvRecord appends one record of the SQLPIPE_CSV file format to b.
+// A NULL value is written as an empty field. Every other value is enclosed
+// in double quotes, so an empty string or a value such as \N is never read
+// back as NULL.
+func AppendCsvRecord(b *strings.Builder, values []string, null []bool) {
+	for i, value := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if null[i] {
+			continue
+		}
+		b.WriteByte('"')
+		b.WriteString(strings.ReplaceAll(value, `"`, `""`))
+		b.WriteByte('"')
+	}
+	b.WriteByte('\n')
+}
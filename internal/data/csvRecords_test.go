@@ -0,0 +1,17 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppendCsvRecord(t *testing.T) {
+	var b strings.Builder
+	AppendCsvRecord(&b, []string{"", "", `\N`, `say "hi"`, "a,b\nc"}, []bool{true, false, false, false, false})
+	AppendCsvRecord(&b, []string{"1"}, []bool{false})
+
+	want := ",\"\",\"\\N\",\"say \"\"hi\"\"\",\"a,b\nc\"\n\"1\"\n"
+	if b.String() != want {
+		t.Errorf("AppendCsvRecord wrote %q, want %q", b.String(), want)
+	}
+}
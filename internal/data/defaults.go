@@ -0,0 +1,177 @@
+package data
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// ColumnMetadata is what the source catalog knows about a column beyond
+// its type: its default constraint definition and, for identity columns,
+// the seed, increment and last value issued.
+type ColumnMetadata struct {
+	Default   string
+	Identity  bool
+	Seed      string
+	Increment string
+	LastValue string
+}
+
+var (
+	numericLiteralRX = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+	stringLiteralRX  = regexp.MustCompile(`^[Nn]?'((?:[^']|'')*)'$`)
+	convertRX        = regexp.MustCompile(`^(?i)(?:CONVERT\(\[?[A-Za-z0-9_ ]+\]?(?:\([0-9, ]*\))?,(.+)\)|CAST\((.+) AS \[?[A-Za-z0-9_ ]+\]?(?:\([0-9, ]*\))?\))$`)
+	integerTypes     = map[string]bool{"TINYINT": true, "SMALLINT": true, "INT": true, "BIGINT": true}
+	textTypes        = map[string]bool{"TEXT": true, "VARCHAR": true}
+)
+
+// ApplyColumnMetadata sets the DEFAULT or AUTOINCREMENT clause of each
+// column of columnInfo that metadata, keyed by lower cased source column
+// name, has a translatable default or identity for. It returns the columns
+// whose default has no Snowflake equivalent, with their definitions.
+func ApplyColumnMetadata(columnInfo *ColumnInfo, metadata map[string]ColumnMetadata) []string {
+	unsupported := []string{}
+	columnInfo.ColumnDefaults = make([]string, columnInfo.NumCols)
+
+	for i, name := range columnInfo.ColumnNames {
+		column, ok := metadata[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		targetType := columnInfo.ColumnTargetTypes[i]
+
+		if column.Identity {
+			if !integerTypes[targetType] {
+				unsupported = append(unsupported, fmt.Sprintf("%v: identity on %v", name, targetType))
+				continue
+			}
+			// New rows continue after the last value the source issued.
+			start := column.Seed
+			if column.LastValue != "" {
+				start = nextIdentity(column.LastValue, column.Increment)
+			}
+			columnInfo.ColumnDefaults[i] = fmt.Sprintf("AUTOINCREMENT START %v INCREMENT %v", start, column.Increment)
+			continue
+		}
+
+		if column.Default == "" {
+			continue
+		}
+		expression, ok := TranslateDefault(column.Default, targetType)
+		if !ok {
+			unsupported = append(unsupported, fmt.Sprintf("%v: %v", name, column.Default))
+			continue
+		}
+		if expression != "" {
+			columnInfo.ColumnDefaults[i] = "DEFAULT " + expression
+		}
+	}
+
+	return unsupported
+}
+
+// nextIdentity returns lastValue + increment. Identity columns can be
+// decimal(38, 0), so the values are added as big integers.
+func nextIdentity(lastValue, increment string) string {
+	last, ok := new(big.Int).SetString(lastValue, 10)
+	if !ok {
+		return lastValue
+	}
+	step, ok := new(big.Int).SetString(increment, 10)
+	if !ok {
+		return lastValue
+	}
+	return last.Add(last, step).String()
+}
+
+// TranslateDefault translates a SQL Server default constraint definition for
+// a column of Snowflake type targetType. It handles literals, conversions of
+// literals and the usual date, user and uniqueidentifier functions; ok is
+// false for anything else. Literals are only kept where Snowflake reads them
+// as the same value: numbers on numeric, boolean and text columns and strings
+// on text columns. A NULL default translates to "".
+func TranslateDefault(definition, targetType string) (expression string, ok bool) {
+	value := stripParens(strings.TrimSpace(definition))
+
+	if match := convertRX.FindStringSubmatch(value); match != nil {
+		return TranslateDefault(match[1]+match[2], targetType)
+	}
+
+	switch strings.ToUpper(value) {
+	case "NULL":
+		return "", true
+	case "GETDATE()", "SYSDATETIME()", "SYSDATETIMEOFFSET()", "CURRENT_TIMESTAMP":
+		switch targetType {
+		case "DATE":
+			return "CURRENT_DATE()", true
+		case "TIME":
+			return "CURRENT_TIME()", true
+		}
+		return "CURRENT_TIMESTAMP()", true
+	case "GETUTCDATE()", "SYSUTCDATETIME()":
+		if targetType == "TIMESTAMP" {
+			return "SYSDATE()", true
+		}
+		return "", false
+	case "NEWID()", "NEWSEQUENTIALID()":
+		return "UUID_STRING()", true
+	case "SUSER_SNAME()", "SUSER_NAME()", "SYSTEM_USER", "USER_NAME()", "USER", "CURRENT_USER":
+		return "CURRENT_USER()", true
+	}
+
+	if numericLiteralRX.MatchString(value) {
+		switch {
+		case targetType == "BOOLEAN":
+			if strings.Trim(value, "+-0.") == "" {
+				return "FALSE", true
+			}
+			return "TRUE", true
+		case textTypes[targetType]:
+			return "'" + value + "'", true
+		case integerTypes[targetType], targetType == "FLOAT", strings.HasPrefix(targetType, "NUMBER"):
+			return value, true
+		}
+		return "", false
+	}
+
+	if match := stringLiteralRX.FindStringSubmatch(value); match != nil {
+		if !textTypes[targetType] {
+			return "", false
+		}
+		return "'" + strings.ReplaceAll(match[1], `\`, `\\`) + "'", true
+	}
+
+	return "", false
+}
+
+// stripParens removes the parentheses SQL Server wraps stored default
+// definitions in, as in ((0)).
+func stripParens(value string) string {
+	for strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") && closingParen(value) == len(value)-1 {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	return value
+}
+
+// closingParen returns the index of the parenthesis closing the one value
+// starts with, skipping string literals, or -1.
+func closingParen(value string) int {
+	depth := 0
+	inString := false
+	for i, r := range value {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case inString:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
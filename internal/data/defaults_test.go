@@ -0,0 +1,35 @@
+package data
+
+import "testing"
+
+func TestTranslateDefault(t *testing.T) {
+	tests := []struct {
+		definition string
+		targetType string
+		want       string
+		ok         bool
+	}{
+		{"((0))", "INT", "0", true},
+		{"((1.5))", "FLOAT", "1.5", true},
+		{"((0))", "BOOLEAN", "FALSE", true},
+		{"((1))", "BOOLEAN", "TRUE", true},
+		{"((42))", "VARCHAR", "'42'", true},
+		{"((0))", "TIMESTAMP", "", false},
+		{"((0))", "BINARY", "", false},
+		{"('')", "INT", "", false},
+		{"('abc')", "TIMESTAMP", "", false},
+		{"(N'a\\b')", "TEXT", "'a\\\\b'", true},
+		{"(CONVERT([int],'5'))", "INT", "", false},
+		{"(CONVERT([nvarchar](10),(5)))", "TEXT", "'5'", true},
+		{"(getdate())", "DATE", "CURRENT_DATE()", true},
+		{"(NULL)", "INT", "", true},
+		{"([dbo].[f]())", "INT", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := TranslateDefault(tt.definition, tt.targetType)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("TranslateDefault(%q, %q) = %q, %v, want %q, %v", tt.definition, tt.targetType, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
+)
+
+// TableFilter selects source tables by name. Each pattern is one of:
+//
+//   - an exact name, "dbo.orders", or just "orders" to match any schema.
+//     Parts may be bracket-quoted, "dbo.[Order]", and * or ? in a name are
+//     matched literally
+//   - a glob in path.Match syntax prefixed with "glob:", "glob:archive.*" or
+//     "glob:*.*_bak"
+//   - a regular expression prefixed with "re:", matched against "schema.table"
+//
+// All matching is case-insensitive. A table is kept when it matches at least
+// one include pattern (or there are none) and no exclude pattern.
+type TableFilter struct {
+	Include []string `json:"include_tables"`
+	Exclude []string `json:"exclude_tables"`
+}
+
+// SkippedNotIncluded is the reason given for tables include_tables does not
+// match.
+const SkippedNotIncluded = "not matched by include_tables"
+
+type SkippedTable struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Reason string `json:"reason"`
+}
+
+type tableMatcher func(schema, table string) bool
+
+func compileTablePattern(pattern string) (tableMatcher, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		rx, err := regexp.Compile("(?i)" + strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return nil, err
+		}
+		return func(schema, table string) bool {
+			return rx.MatchString(schema + "." + table)
+		}, nil
+	}
+
+	if strings.HasPrefix(pattern, "glob:") {
+		return compileTableGlob(strings.ToLower(strings.TrimPrefix(pattern, "glob:")))
+	}
+
+	schemaName, tableName, hasSchema, err := splitTableName(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(schema, table string) bool {
+		return (!hasSchema || strings.EqualFold(schema, schemaName)) && strings.EqualFold(table, tableName)
+	}, nil
+}
+
+func compileTableGlob(pattern string) (tableMatcher, error) {
+	schemaPattern, tablePattern, hasSchema := strings.Cut(pattern, ".")
+	if !hasSchema {
+		schemaPattern, tablePattern = "*", pattern
+	}
+
+	// path.Match only reports a bad pattern when it gets far enough to
+	// notice, so check both halves against an empty name up front.
+	for _, p := range []string{schemaPattern, tablePattern} {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(schema, table string) bool {
+		schemaOk, _ := path.Match(schemaPattern, strings.ToLower(schema))
+		tableOk, _ := path.Match(tablePattern, strings.ToLower(table))
+		return schemaOk && tableOk
+	}, nil
+}
+
+// splitTableName splits "schema.table" or "table" into its parts, removing
+// the brackets from quoted parts such as "[my.schema].[Order]".
+func splitTableName(name string) (schema, table string, hasSchema bool, err error) {
+	parts := []string{}
+	part := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '[' && part.Len() == 0:
+			end := i + 1
+			for {
+				closing := strings.IndexByte(name[end:], ']')
+				if closing < 0 {
+					return "", "", false, fmt.Errorf("unclosed [ in %q", name)
+				}
+				part.WriteString(name[end : end+closing])
+				end += closing + 1
+				if end < len(name) && name[end] == ']' {
+					part.WriteByte(']')
+					end++
+					continue
+				}
+				break
+			}
+			i = end - 1
+			if end < len(name) && name[end] != '.' {
+				return "", "", false, fmt.Errorf("unexpected %q after ] in %q", name[end], name)
+			}
+		case name[i] == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(name[i])
+		}
+	}
+	parts = append(parts, part.String())
+
+	for _, part := range parts {
+		if part == "" {
+			return "", "", false, fmt.Errorf("empty name part in %q", name)
+		}
+	}
+
+	switch len(parts) {
+	case 1:
+		return "", parts[0], false, nil
+	case 2:
+		return parts[0], parts[1], true, nil
+	default:
+		return "", "", false, fmt.Errorf("%q has more than a schema and a table name", name)
+	}
+}
+
+func ValidateTableFilter(v *validator.Validator, filter TableFilter) {
+	for key, patterns := range map[string][]string{
+		"include_tables": filter.Include,
+		"exclude_tables": filter.Exclude,
+	} {
+		for _, pattern := range patterns {
+			if pattern == "" {
+				v.AddError(key, "must not contain empty patterns")
+				continue
+			}
+			if _, err := compileTablePattern(pattern); err != nil {
+				v.AddError(key, fmt.Sprintf("invalid pattern %q: %v", pattern, err))
+			}
+		}
+	}
+}
+
+// Apply splits queries into the ones the filter keeps and a report of the
+// ones it drops.
+func (filter TableFilter) Apply(queries []Query) ([]Query, []SkippedTable, error) {
+	includes := make([]tableMatcher, len(filter.Include))
+	for i, pattern := range filter.Include {
+		matcher, err := compileTablePattern(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid include pattern %q: %v", pattern, err)
+		}
+		includes[i] = matcher
+	}
+
+	excludes := make([]tableMatcher, len(filter.Exclude))
+	for i, pattern := range filter.Exclude {
+		matcher, err := compileTablePattern(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+		excludes[i] = matcher
+	}
+
+	kept := []Query{}
+	skipped := []SkippedTable{}
+
+queries:
+	for _, query := range queries {
+		if len(includes) > 0 {
+			included := false
+			for _, matches := range includes {
+				if matches(query.Schema, query.Table) {
+					included = true
+					break
+				}
+			}
+			if !included {
+				skipped = append(skipped, SkippedTable{
+					Schema: query.Schema,
+					Table:  query.Table,
+					Reason: SkippedNotIncluded,
+				})
+				continue
+			}
+		}
+
+		for i, matches := range excludes {
+			if matches(query.Schema, query.Table) {
+				skipped = append(skipped, SkippedTable{
+					Schema: query.Schema,
+					Table:  query.Table,
+					Reason: fmt.Sprintf("matched exclude_tables pattern %q", filter.Exclude[i]),
+				})
+				continue queries
+			}
+		}
+
+		kept = append(kept, query)
+	}
+
+	return kept, skipped, nil
+}
@@ -0,0 +1,49 @@
+package data
+
+import "testing"
+
+func TestTableFilterPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		schema  string
+		table   string
+		want    bool
+	}{
+		{"dbo.orders", "DBO", "Orders", true},
+		{"dbo.orders", "sales", "orders", false},
+		{"dbo.[Order]", "dbo", "Order", true},
+		{"dbo.[Order]", "dbo", "O", false},
+		{"[my.schema].[a]]b]", "my.schema", "a]b", true},
+		{"dbo.orders_?", "dbo", "orders_?", true},
+		{"dbo.orders_?", "dbo", "orders_1", false},
+		{"dbo.*", "dbo", "orders", false},
+		{"orders", "sales", "Orders", true},
+		{"orders", "sales", "orders_bak", false},
+		{"glob:archive.*", "Archive", "orders", true},
+		{"glob:archive.*", "dbo", "orders", false},
+		{"glob:*.*_bak", "dbo", "orders_bak", true},
+		{"glob:*_bak", "sales", "orders_bak", true},
+		{"glob:*_bak", "sales", "orders", false},
+		{"glob:dbo.[Oo]rders", "dbo", "orders", true},
+		{"re:^staging\\.", "Staging", "orders", true},
+		{"re:^staging\\.", "dbo", "staging", false},
+		{"re:_(bak|old)$", "dbo", "orders_OLD", true},
+	}
+
+	for _, tt := range tests {
+		matches, err := compileTablePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileTablePattern(%q) returned %v", tt.pattern, err)
+		}
+		if got := matches(tt.schema, tt.table); got != tt.want {
+			t.Errorf("%q matching %v.%v = %v, want %v", tt.pattern, tt.schema, tt.table, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"dbo.[orders", "dbo.[a]b", "db.dbo.orders", "dbo.", "glob:dbo.[", "re:("} {
+		_, err := compileTablePattern(pattern)
+		if err == nil {
+			t.Errorf("compileTablePattern(%q) returned no error", pattern)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Fingerprint is one aggregate computed over a column on both sides of a
+// transfer. Source and Target are SQL expressions that render the aggregate
+// as text; Approximate marks float sums, which are compared with a relative
+// tolerance because the two databases add in different orders.
+type Fingerprint struct {
+	Column      string
+	Check       string
+	Source      string
+	Target      string
+	Approximate bool
+}
+
+type ColumnValidation struct {
+	Column string `json:"column"`
+	Check  string `json:"check"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Match  bool   `json:"match"`
+}
+
+type TableValidation struct {
+	Status     string             `json:"status"`
+	Mismatches int                `json:"mismatches"`
+	Skipped    []string           `json:"skipped_columns,omitempty"`
+	Columns    []ColumnValidation `json:"columns"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// Fingerprints lists the aggregates that check each column of columnInfo,
+// along with the columns whose type has no comparable aggregate. The target
+// side accounts for how the MSSQL driver stores each type.
+func Fingerprints(columnInfo ColumnInfo) ([]Fingerprint, []string) {
+	fingerprints := []Fingerprint{{
+		Check:  "row_count",
+		Source: "convert(varchar(40), count_big(*))",
+		Target: "to_varchar(count(*))",
+	}}
+	skipped := []string{}
+
+	for i, name := range columnInfo.ColumnNames {
+		src := QuoteMssqlIdentifier(name)
+		tgt := columnInfo.TargetColumnNames[i]
+
+		add := func(check, source, target string, approximate bool) {
+			fingerprints = append(fingerprints, Fingerprint{
+				Column:      name,
+				Check:       check,
+				Source:      source,
+				Target:      target,
+				Approximate: approximate,
+			})
+		}
+
+		dbType := columnInfo.ColumnDbTypes[i]
+
+		switch dbType {
+		case "SQL_VARIANT", "GEOMETRY", "XML", "DATETIMEOFFSET":
+			skipped = append(skipped, name)
+			continue
+		}
+
+		add("count", fmt.Sprintf("convert(varchar(40), count_big(%v))", src), fmt.Sprintf("to_varchar(count(%v))", tgt), false)
+
+		switch dbType {
+		case "TINYINT", "SMALLINT", "INT":
+			add("sum", fmt.Sprintf("convert(varchar(40), sum(convert(decimal(38, 0), %v)))", src), fmt.Sprintf("to_varchar(sum(%v))", tgt), false)
+			// CHECKSUM_AGG over an int column is the XOR of its values.
+			add("checksum_agg", fmt.Sprintf("convert(varchar(40), checksum_agg(convert(int, %v)))", src), fmt.Sprintf("to_varchar(bitxor_agg(%v))", tgt), false)
+		case "BIGINT":
+			add("sum", fmt.Sprintf("convert(varchar(40), sum(convert(decimal(38, 0), %v)))", src), fmt.Sprintf("to_varchar(sum(%v))", tgt), false)
+		case "BIT":
+			add("sum", fmt.Sprintf("convert(varchar(40), sum(convert(int, %v)))", src), fmt.Sprintf("to_varchar(count_if(%v))", tgt), false)
+		case "FLOAT", "REAL", "DECIMAL":
+			add("sum", fmt.Sprintf("convert(varchar(40), sum(convert(float, %v)), 3)", src), fmt.Sprintf("to_varchar(sum(%v))", tgt), true)
+		case "MONEY", "SMALLMONEY":
+			add("sum", fmt.Sprintf("convert(varchar(40), sum(convert(decimal(38, 4), %v)))", src), fmt.Sprintf("to_varchar(sum(try_to_decimal(%v, 38, 4)))", tgt), false)
+		case "DATE":
+			add("min", fmt.Sprintf("convert(varchar(40), datediff_big(day, '1970-01-01', min(%v)))", src), fmt.Sprintf("to_varchar(datediff(day, '1970-01-01'::date, min(%v)))", tgt), false)
+			add("max", fmt.Sprintf("convert(varchar(40), datediff_big(day, '1970-01-01', max(%v)))", src), fmt.Sprintf("to_varchar(datediff(day, '1970-01-01'::date, max(%v)))", tgt), false)
+		case "DATETIME", "DATETIME2", "SMALLDATETIME":
+			add("min", fmt.Sprintf("convert(varchar(40), datediff_big(millisecond, '1970-01-01', min(%v)))", src), fmt.Sprintf("to_varchar(date_part(epoch_millisecond, min(%v)))", tgt), false)
+			add("max", fmt.Sprintf("convert(varchar(40), datediff_big(millisecond, '1970-01-01', max(%v)))", src), fmt.Sprintf("to_varchar(date_part(epoch_millisecond, max(%v)))", tgt), false)
+		case "TIME":
+			add("min", fmt.Sprintf("convert(varchar(40), datediff(millisecond, '00:00:00', min(%v)))", src), fmt.Sprintf("to_varchar(datediff(millisecond, '00:00:00'::time, min(%v)))", tgt), false)
+			add("max", fmt.Sprintf("convert(varchar(40), datediff(millisecond, '00:00:00', max(%v)))", src), fmt.Sprintf("to_varchar(datediff(millisecond, '00:00:00'::time, max(%v)))", tgt), false)
+		case "CHAR", "VARCHAR", "NCHAR", "NVARCHAR", "TEXT", "NTEXT":
+			// LEN ignores trailing spaces, so measure with a sentinel appended.
+			add("length_sum", fmt.Sprintf("convert(varchar(40), sum(convert(bigint, len(convert(nvarchar(max), %v) + N'x') - 1)))", src), fmt.Sprintf("to_varchar(sum(length(%v)))", tgt), false)
+		case "BINARY", "VARBINARY", "IMAGE":
+			add("length_sum", fmt.Sprintf("convert(varchar(40), sum(convert(bigint, datalength(%v))))", src), fmt.Sprintf("to_varchar(sum(length(%v)))", tgt), false)
+		case "UNIQUEIDENTIFIER":
+			// The first three bytes of the MD5 of each canonical GUID string,
+			// summed; catches byte order mistakes a count cannot.
+			add("md5_sum", fmt.Sprintf("convert(varchar(40), sum(convert(bigint, convert(binary(3), hashbytes('MD5', convert(char(36), %v))))))", src), fmt.Sprintf("to_varchar(sum(to_number(substr(md5(upper(%v)), 1, 6), 'XXXXXX')))", tgt), false)
+		}
+	}
+
+	return fingerprints, skipped
+}
+
+// SourceFingerprintQuery computes every fingerprint over sourceQuery.
+func SourceFingerprintQuery(fingerprints []Fingerprint, sourceQuery string) string {
+	expressions := make([]string, len(fingerprints))
+	for i, fingerprint := range fingerprints {
+		expressions[i] = fingerprint.Source
+	}
+	return fmt.Sprintf("select %v from (%v) as sqlpipe_validate", strings.Join(expressions, ", "), sourceQuery)
+}
+
+// TargetFingerprintQuery computes every fingerprint over a Snowflake table.
+func TargetFingerprintQuery(fingerprints []Fingerprint, table string) string {
+	expressions := make([]string, len(fingerprints))
+	for i, fingerprint := range fingerprints {
+		expressions[i] = fingerprint.Target
+	}
+	return fmt.Sprintf("select %v from %v", strings.Join(expressions, ", "), table)
+}
+
+// CompareFingerprints pairs up the values both queries returned.
+func CompareFingerprints(fingerprints []Fingerprint, skipped []string, sourceValues, targetValues []sql.NullString) TableValidation {
+	validation := TableValidation{
+		Status:  "match",
+		Skipped: skipped,
+		Columns: make([]ColumnValidation, len(fingerprints)),
+	}
+
+	for i, fingerprint := range fingerprints {
+		column := ColumnValidation{
+			Column: fingerprint.Column,
+			Check:  fingerprint.Check,
+			Source: sourceValues[i].String,
+			Target: targetValues[i].String,
+		}
+		column.Match = fingerprintsMatch(column.Source, column.Target, fingerprint.Approximate)
+
+		if !column.Match {
+			validation.Status = "mismatch"
+			validation.Mismatches++
+		}
+
+		validation.Columns[i] = column
+	}
+
+	return validation
+}
+
+func fingerprintsMatch(source, target string, approximate bool) bool {
+	if source == target {
+		return true
+	}
+
+	sourceValue, ok := new(big.Float).SetPrec(128).SetString(strings.TrimSpace(source))
+	if !ok {
+		return false
+	}
+	targetValue, ok := new(big.Float).SetPrec(128).SetString(strings.TrimSpace(target))
+	if !ok {
+		return false
+	}
+
+	if !approximate {
+		return sourceValue.Cmp(targetValue) == 0
+	}
+
+	diff := new(big.Float).Sub(sourceValue, targetValue)
+	diff.Abs(diff)
+	scale := new(big.Float).Abs(sourceValue)
+	if scale.Cmp(big.NewFloat(1)) < 0 {
+		scale = big.NewFloat(1)
+	}
+
+	return diff.Cmp(new(big.Float).Mul(scale, big.NewFloat(1e-9))) <= 0
+}
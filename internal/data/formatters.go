@@ -6,7 +6,7 @@ import (
 	"time"
 )
 
-var Formatters = map[string]func(value interface{}) (string, error){
+var mssqlFormatters = map[string]func(value interface{}) (string, error){
 	"BIT":              csvCastToBoolWriteBinaryEquivalent,
 	"FLOAT":            csvPrintRaw,
 	"DOUBLE":           csvPrintRaw,
@@ -0,0 +1,314 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	mssql "github.com/calmitchell617/go-mssqldb"
+	"github.com/calmitchell617/go-mssqldb/msdsn"
+)
+
+type mssqlDriver struct{}
+
+func (mssqlDriver) Name() string {
+	return "MSSQL"
+}
+
+func (mssqlDriver) QuoteIdentifier(name string) string {
+	return QuoteMssqlIdentifier(name)
+}
+
+// DiscoverTables lists the user tables in the source database, largest first
+// so the longest transfers start earliest.
+func (driver mssqlDriver) DiscoverTables(ctx context.Context, db Queryer) ([]Query, error) {
+	schemaRows, err := db.QueryContext(
+		ctx,
+		// Diagram support tables carry a microsoft_database_tools_support
+		// property; other extended properties, such as descriptions, do not
+		// exclude a table.
+		`SELECT
+		S.name as schema_name,
+		T.name as table_name,
+		sum(a.used_pages) * 8 / 1024 as used_mb,
+		T.temporal_type,
+		HS.name as history_schema,
+		HT.name as history_table,
+		T.is_memory_optimized
+	FROM sys.tables AS T
+	INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id
+	LEFT JOIN sys.tables AS HT ON HT.object_id = T.history_table_id
+	LEFT JOIN sys.schemas AS HS ON HS.schema_id = HT.schema_id
+	
+	LEFT JOIN sys.indexes i ON T.OBJECT_ID = i.object_id
+	LEFT JOIN sys.partitions p ON i.object_id = p.OBJECT_ID AND i.index_id = p.index_id
+	LEFT JOIN sys.allocation_units a ON p.partition_id = a.container_id
+	
+	WHERE T.is_ms_shipped = 0
+	AND NOT EXISTS (
+		SELECT 1 FROM sys.extended_properties AS EP
+		WHERE EP.class = 1 AND EP.major_id = T.[object_id] AND EP.minor_id = 0 AND EP.[name] = 'microsoft_database_tools_support'
+	)
+	GROUP BY
+		t.Name, s.Name, T.temporal_type, HS.name, HT.name, T.is_memory_optimized
+	ORDER BY sum(used_pages) DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error running query getting all db objects: %v", err)
+	}
+	defer schemaRows.Close()
+
+	var sourceSchema string
+	var sourceTable string
+	var usedMB sql.NullInt64
+	var temporalType int
+	var historySchema, historyTable sql.NullString
+	var memoryOptimized bool
+	queries := []Query{}
+	for schemaRows.Next() {
+		err := schemaRows.Scan(&sourceSchema, &sourceTable, &usedMB, &temporalType, &historySchema, &historyTable, &memoryOptimized)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning schema and table into query object: %v", err)
+		}
+
+		query := Query{
+			Schema:          sourceSchema,
+			Table:           sourceTable,
+			SourceQuery:     SelectQuery(driver, sourceSchema, sourceTable, nil),
+			SizeMB:          usedMB.Int64,
+			HistorySchema:   historySchema.String,
+			HistoryTable:    historyTable.String,
+			MemoryOptimized: memoryOptimized,
+		}
+		switch temporalType {
+		case 1:
+			query.Temporal = TemporalHistory
+		case 2:
+			query.Temporal = TemporalSystemVersioned
+		}
+
+		queries = append(queries, query)
+	}
+	err = schemaRows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over schemaRows: %v", err)
+	}
+
+	return queries, nil
+}
+
+// TableColumns returns the column names of schema.table, which may also be a
+// view, in ordinal order.
+func (mssqlDriver) TableColumns(ctx context.Context, db Queryer, schema, table string) ([]string, error) {
+	return queryColumns(
+		ctx,
+		db,
+		`SELECT C.name
+	FROM sys.columns AS C
+	INNER JOIN sys.objects AS T ON T.object_id = C.object_id
+	INNER JOIN sys.schemas AS S ON S.schema_id = T.schema_id
+	WHERE S.name = @p1 AND T.name = @p2 AND T.type IN ('U', 'V')
+	ORDER BY C.column_id`,
+		schema,
+		table,
+	)
+}
+
+func (mssqlDriver) SnowflakeType(dbType string, precision, scale int64) (string, error) {
+	switch dbType {
+	case "BIGINT":
+		return "BIGINT", nil
+	case "BIT":
+		return "BOOLEAN", nil
+	case "INT":
+		return "INT", nil
+	case "MONEY":
+		return "TEXT", nil
+	case "SMALLINT":
+		return "SMALLINT", nil
+	case "SMALLMONEY":
+		return "TEXT", nil
+	case "TINYINT":
+		return "TINYINT", nil
+	case "FLOAT":
+		return "FLOAT", nil
+	case "REAL":
+		return "FLOAT", nil
+	case "DATE":
+		return "DATE", nil
+	case "DATETIME2":
+		return "TIMESTAMP", nil
+	case "DATETIME":
+		return "TIMESTAMP", nil
+	case "DATETIMEOFFSET":
+		return "TIMESTAMP", nil
+	case "SMALLDATETIME":
+		return "TIMESTAMP", nil
+	case "TIME":
+		return "TIME", nil
+	case "TEXT":
+		return "TEXT", nil
+	case "NTEXT":
+		return "TEXT", nil
+	case "BINARY":
+		return "BINARY", nil
+	case "VARBINARY":
+		return "BINARY", nil
+	case "UNIQUEIDENTIFIER":
+		return "TEXT", nil
+	case "XML":
+		return "TEXT", nil
+	case "IMAGE":
+		return "BINARY", nil
+	case "DECIMAL":
+		return "FLOAT", nil
+	case "CHAR":
+		return "VARCHAR", nil
+	case "VARCHAR":
+		return "VARCHAR", nil
+	case "NCHAR":
+		return "VARCHAR", nil
+	case "NVARCHAR":
+		return "VARCHAR", nil
+	case "SQL_VARIANT":
+		return "TEXT", nil
+	case "GEOMETRY":
+		return "BINARY", nil
+	}
+	return "", fmt.Errorf("unknown type while getting create table types: %v", dbType)
+}
+
+func (mssqlDriver) Formatter(dbType string) (func(value interface{}) (string, error), bool) {
+	formatter, ok := mssqlFormatters[dbType]
+	return formatter, ok
+}
+
+// mssqlDSN builds a go-mssqldb URL connection string.
+func mssqlDSN(source *Source) string {
+	query := url.Values{}
+	query.Add("database", source.DbName)
+
+	if source.Encrypt != "" {
+		query.Add("encrypt", source.Encrypt)
+	}
+	if source.TrustServerCertificate != nil {
+		query.Add("TrustServerCertificate", strconv.FormatBool(*source.TrustServerCertificate))
+	}
+	if source.Certificate != "" {
+		query.Add("certificate", source.Certificate)
+	}
+	if source.HostNameInCertificate != "" {
+		query.Add("hostNameInCertificate", source.HostNameInCertificate)
+	}
+	if source.ApplicationIntent != "" {
+		query.Add("ApplicationIntent", source.ApplicationIntent)
+	}
+	// The driver already dials every address a listener name resolves to
+	// in parallel; the parameter is passed on for drivers that need it.
+	if source.MultiSubnetFailover {
+		query.Add("MultiSubnetFailover", "true")
+	}
+	if source.ConnectionTimeout != 0 {
+		query.Add("connection timeout", strconv.Itoa(source.ConnectionTimeout))
+	}
+	if source.DialTimeout != 0 {
+		query.Add("dial timeout", strconv.Itoa(source.DialTimeout))
+	}
+
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		Host:     source.Host,
+		RawQuery: query.Encode(),
+	}
+
+	if source.Instance != "" {
+		u.Path = "/" + source.Instance
+	} else {
+		u.Host = fmt.Sprintf("%s:%d", source.Host, source.Port)
+	}
+
+	switch source.Authentication {
+	case "", SourceAuthSql, SourceAuthAzureAdPassword:
+		u.User = url.UserPassword(source.Username, source.Password)
+	case SourceAuthNtlm:
+		u.User = url.UserPassword(source.Domain+`\`+source.Username, source.Password)
+	}
+
+	return u.String()
+}
+
+func (mssqlDriver) Open(source *Source) (*sql.DB, error) {
+	if !source.azureAd() {
+		sourceDb, err := sql.Open("mssql", mssqlDSN(source))
+		if err != nil {
+			return nil, fmt.Errorf("unable to open source db, err: %v", err)
+		}
+
+		return sourceDb, nil
+	}
+
+	config, _, err := msdsn.Parse(mssqlDSN(source))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse source connection string, err: %v", err)
+	}
+
+	workflow := byte(mssql.FedAuthADALWorkflowPassword)
+	if source.Authentication == SourceAuthAzureAdManagedIdentity {
+		workflow = mssql.FedAuthADALWorkflowMSI
+	}
+
+	connector, err := mssql.NewActiveDirectoryTokenConnector(config, workflow, source.azureAdToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create azure ad connector, err: %v", err)
+	}
+
+	return sql.OpenDB(connector), nil
+}
+
+// azureAdToken gets a token for the server's resource from the tenant the
+// server names during login, unless TenantId overrides it.
+func (source *Source) azureAdToken(ctx context.Context, serverSPN, stsURL string) (string, error) {
+	tenant := source.TenantId
+	if tenant == "" {
+		tenant = stsURL[strings.LastIndex(stsURL, "/")+1:]
+	}
+
+	var credential azcore.TokenCredential
+	var err error
+
+	switch source.Authentication {
+	case SourceAuthAzureAdPassword:
+		credential, err = azidentity.NewUsernamePasswordCredential(tenant, source.ClientId, source.Username, source.Password, nil)
+	case SourceAuthAzureAdServicePrincipal:
+		credential, err = azidentity.NewClientSecretCredential(tenant, source.ClientId, source.Password, nil)
+	case SourceAuthAzureAdManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if source.ClientId != "" {
+			options.ID = azidentity.ClientID(source.ClientId)
+		}
+		credential, err = azidentity.NewManagedIdentityCredential(options)
+	default:
+		credential, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{TenantID: source.TenantId})
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to create azure ad credential, err: %v", err)
+	}
+
+	scope := strings.TrimRight(serverSPN, "/")
+	if !strings.HasSuffix(scope, "/.default") {
+		scope += "/.default"
+	}
+
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+	if err != nil {
+		return "", fmt.Errorf("unable to get azure ad token, err: %v", err)
+	}
+
+	return token.Token, nil
+}
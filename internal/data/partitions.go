@@ -0,0 +1,74 @@
+package data
+
+import (
+	"fmt"
+)
+
+const (
+	PartitionByKey    = "key"
+	PartitionByNative = "native"
+)
+
+// KeyRangePredicates splits [min, max] of an integer column into at most n
+// contiguous ranges of equal width. The first range is unbounded below and
+// also takes NULLs, and the last is unbounded above, so the ranges together
+// cover every row even if keys outside [min, max] appear after the bounds
+// were read.
+func KeyRangePredicates(column string, min, max int64, n int) []string {
+	column = QuoteMssqlIdentifier(column)
+
+	// Unsigned arithmetic keeps the width right across the whole int64 range.
+	width := uint64(max - min)
+	if n < 1 {
+		n = 1
+	}
+	if width < uint64(n) {
+		n = int(width) + 1
+	}
+	if n == 1 {
+		return []string{"1 = 1"}
+	}
+	step := width / uint64(n)
+	if width%uint64(n) != 0 {
+		step++
+	}
+
+	predicates := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		lo := min + int64(uint64(i)*step)
+		hi := min + int64(uint64(i+1)*step)
+
+		var predicate string
+		switch i {
+		case 0:
+			predicate = fmt.Sprintf("(%v < %v or %v is null)", column, hi, column)
+		case n - 1:
+			predicate = fmt.Sprintf("%v >= %v", column, lo)
+		default:
+			predicate = fmt.Sprintf("%v >= %v and %v < %v", column, lo, column, hi)
+		}
+
+		predicates = append(predicates, predicate)
+	}
+
+	return predicates
+}
+
+// NativePartitionPredicates selects each of a partition function's count
+// partitions in turn.
+func NativePartitionPredicates(function, column string, count int) []string {
+	predicates := make([]string, count)
+	for i := range predicates {
+		predicates[i] = fmt.Sprintf("$PARTITION.%v(%v) = %v", QuoteMssqlIdentifier(function), QuoteMssqlIdentifier(column), i+1)
+	}
+	return predicates
+}
+
+// RangeQueries restricts sourceQuery to each predicate in turn.
+func RangeQueries(sourceQuery string, predicates []string) []string {
+	queries := make([]string, len(predicates))
+	for i, predicate := range predicates {
+		queries[i] = fmt.Sprintf("select * from (%v) as sqlpipe_range where %v", sourceQuery, predicate)
+	}
+	return queries
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestKeyRangePredicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int64
+		n        int
+		want     []string
+	}{
+		{
+			name: "single range",
+			min:  1,
+			max:  100,
+			n:    1,
+			want: []string{"1 = 1"},
+		},
+		{
+			name: "no ranges requested",
+			min:  1,
+			max:  100,
+			n:    0,
+			want: []string{"1 = 1"},
+		},
+		{
+			name: "even split",
+			min:  0,
+			max:  9,
+			n:    3,
+			want: []string{
+				"([id] < 3 or [id] is null)",
+				"[id] >= 3 and [id] < 6",
+				"[id] >= 6",
+			},
+		},
+		{
+			name: "width smaller than n",
+			min:  10,
+			max:  12,
+			n:    8,
+			want: []string{
+				"([id] < 11 or [id] is null)",
+				"[id] >= 11 and [id] < 12",
+				"[id] >= 12",
+			},
+		},
+		{
+			name: "single key",
+			min:  5,
+			max:  5,
+			n:    4,
+			want: []string{"1 = 1"},
+		},
+		{
+			name: "negative keys",
+			min:  -10,
+			max:  -1,
+			n:    3,
+			want: []string{
+				"([id] < -7 or [id] is null)",
+				"[id] >= -7 and [id] < -4",
+				"[id] >= -4",
+			},
+		},
+		{
+			name: "keys across zero",
+			min:  -5,
+			max:  4,
+			n:    2,
+			want: []string{
+				"([id] < 0 or [id] is null)",
+				"[id] >= 0",
+			},
+		},
+		{
+			name: "whole int64 range",
+			min:  math.MinInt64,
+			max:  math.MaxInt64,
+			n:    2,
+			want: []string{
+				"([id] < 0 or [id] is null)",
+				"[id] >= 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := KeyRangePredicates("id", tt.min, tt.max, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("KeyRangePredicates(%v, %v, %v) = %q, want %q", tt.min, tt.max, tt.n, got, tt.want)
+			}
+		})
+	}
+}
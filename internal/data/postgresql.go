@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
+)
+
+type postgresqlDriver struct{}
+
+func validatePostgresqlSource(v *validator.Validator, source Source) {
+	v.Check(source.Port > 0 && source.Port <= 65535, "source_port", "must be between 1 and 65535")
+	v.Check(source.Username != "", "source_username", "must be provided")
+	v.Check(source.Password != "", "source_password", "must be provided")
+	v.Check(validator.PermittedValue(strings.ToLower(source.Encrypt), "", "true", "false", "disable"), "source_encrypt", "must be true, false or disable")
+	v.Check(source.Certificate == "" || (source.Encrypt == "" || strings.EqualFold(source.Encrypt, "true")), "source_certificate", "cannot be used when encryption is disabled")
+	v.Check(source.Certificate == "" || source.TrustServerCertificate == nil || !*source.TrustServerCertificate, "source_certificate", "cannot be combined with source_trust_server_certificate")
+
+	for key, unset := range map[string]bool{
+		"source_instance":                 source.Instance == "",
+		"source_authentication":           source.Authentication == "" || source.Authentication == SourceAuthSql,
+		"source_domain":                   source.Domain == "",
+		"source_tenant_id":                source.TenantId == "",
+		"source_client_id":                source.ClientId == "",
+		"source_host_name_in_certificate": source.HostNameInCertificate == "",
+		"source_application_intent":       source.ApplicationIntent == "",
+		"source_multi_subnet_failover":    !source.MultiSubnetFailover,
+		"source_dial_timeout":             source.DialTimeout == 0,
+	} {
+		v.Check(unset, key, "is not supported for postgresql sources")
+	}
+}
+
+func (postgresqlDriver) Name() string {
+	return "POSTGRESQL"
+}
+
+// Open connects with lib/pq. Encryption is required unless disabled, and the
+// server certificate is verified against Certificate, or the system roots
+// when TrustServerCertificate is false.
+func (postgresqlDriver) Open(source *Source) (*sql.DB, error) {
+	query := url.Values{}
+
+	switch {
+	case strings.EqualFold(source.Encrypt, "false") || strings.EqualFold(source.Encrypt, "disable"):
+		query.Add("sslmode", "disable")
+	case source.Certificate != "":
+		query.Add("sslmode", "verify-full")
+		query.Add("sslrootcert", source.Certificate)
+	case source.TrustServerCertificate != nil && !*source.TrustServerCertificate:
+		query.Add("sslmode", "verify-full")
+	default:
+		query.Add("sslmode", "require")
+	}
+	if source.ConnectionTimeout != 0 {
+		query.Add("connect_timeout", strconv.Itoa(source.ConnectionTimeout))
+	}
+
+	u := &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(source.Username, source.Password),
+		Host:     fmt.Sprintf("%s:%d", source.Host, source.Port),
+		Path:     "/" + source.DbName,
+		RawQuery: query.Encode(),
+	}
+
+	sourceDb, err := sql.Open("postgres", u.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to open source db, err: %v", err)
+	}
+
+	return sourceDb, nil
+}
+
+func (postgresqlDriver) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// DiscoverTables lists ordinary and partitioned tables outside the system
+// schemas, largest first. Partitions are read through their parent.
+func (driver postgresqlDriver) DiscoverTables(ctx context.Context, db Queryer) ([]Query, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT N.nspname, C.relname, pg_total_relation_size(C.oid) / 1048576
+	FROM pg_class AS C
+	INNER JOIN pg_namespace AS N ON N.oid = C.relnamespace
+	WHERE C.relkind IN ('r', 'p')
+	AND NOT C.relispartition
+	AND N.nspname NOT IN ('pg_catalog', 'information_schema')
+	AND N.nspname NOT LIKE 'pg\_toast%'
+	AND N.nspname NOT LIKE 'pg\_temp\_%'
+	ORDER BY pg_total_relation_size(C.oid) DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error running query getting all db objects: %v", err)
+	}
+	defer rows.Close()
+
+	queries := []Query{}
+	for rows.Next() {
+		var schema, table string
+		var usedMB sql.NullInt64
+		err := rows.Scan(&schema, &table, &usedMB)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning schema and table into query object: %v", err)
+		}
+
+		queries = append(queries, Query{
+			Schema:      schema,
+			Table:       table,
+			SourceQuery: SelectQuery(driver, schema, table, nil),
+			SizeMB:      usedMB.Int64,
+		})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over tables: %v", err)
+	}
+
+	return queries, nil
+}
+
+func (postgresqlDriver) TableColumns(ctx context.Context, db Queryer, schema, table string) ([]string, error) {
+	return queryColumns(
+		ctx,
+		db,
+		`SELECT A.attname
+	FROM pg_attribute AS A
+	INNER JOIN pg_class AS C ON C.oid = A.attrelid
+	INNER JOIN pg_namespace AS N ON N.oid = C.relnamespace
+	WHERE N.nspname = $1 AND C.relname = $2 AND A.attnum > 0 AND NOT A.attisdropped
+	ORDER BY A.attnum`,
+		schema,
+		table,
+	)
+}
+
+// SnowflakeType maps the type names lib/pq reports. Types it has no name for,
+// such as enums, domains and extension types, arrive as text and load as
+// VARCHAR, as do arrays, ranges, JSON and network types.
+func (postgresqlDriver) SnowflakeType(dbType string, precision, scale int64) (string, error) {
+	switch dbType {
+	case "INT2":
+		return "SMALLINT", nil
+	case "INT4":
+		return "INT", nil
+	case "INT8", "OID":
+		return "BIGINT", nil
+	case "FLOAT4", "FLOAT8":
+		return "FLOAT", nil
+	case "NUMERIC":
+		// Unconstrained numerics report a precision above Snowflake's limit.
+		if precision > 0 && precision <= 38 {
+			return fmt.Sprintf("NUMBER(%v, %v)", precision, scale), nil
+		}
+		return "FLOAT", nil
+	case "BOOL":
+		return "BOOLEAN", nil
+	case "DATE":
+		return "DATE", nil
+	case "TIMESTAMP":
+		return "TIMESTAMP_NTZ", nil
+	case "TIMESTAMPTZ":
+		return "TIMESTAMP_TZ", nil
+	case "TIME":
+		return "TIME", nil
+	case "BYTEA":
+		return "BINARY", nil
+	}
+	return "VARCHAR", nil
+}
+
+var postgresqlFormatters = map[string]func(value interface{}) (string, error){
+	"INT2":        csvPrintRaw,
+	"INT4":        csvPrintRaw,
+	"INT8":        csvPrintRaw,
+	"FLOAT4":      csvPrintRaw,
+	"FLOAT8":      csvPrintRaw,
+	"BOOL":        csvCastToBoolWriteBinaryEquivalent,
+	"DATE":        csvCastToTimeFormatToTimetampString,
+	"TIMESTAMP":   csvCastToTimeFormatToTimetampString,
+	"TIMESTAMPTZ": csvCastToTimeFormatToTimestampTzString,
+	"TIME":        csvCastToTimeFormatToTimeString,
+	"TIMETZ":      csvCastToTimeFormatToTimeTzString,
+	"BYTEA":       csvCastToBytesCastToHexString,
+}
+
+func (postgresqlDriver) Formatter(dbType string) (func(value interface{}) (string, error), bool) {
+	formatter, ok := postgresqlFormatters[dbType]
+	if !ok {
+		return csvPrintText, true
+	}
+	return formatter, true
+}
+
+// csvPrintText writes values lib/pq returns as either strings or the raw
+// bytes of their text representation.
+func csvPrintText(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case []byte:
+		return csvCastToBytesCastToString(value)
+	default:
+		return csvPrintRaw(value)
+	}
+}
+
+func csvCastToTimeFormatToTimestampTzString(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	valTime, ok := value.(time.Time)
+	if !ok {
+		return ``, errors.New(`castToTimeFormatToTimestampTzString unable to cast value to time`)
+	}
+	return valTime.Format("2006-01-02 15:04:05.000000 -07:00"), nil
+}
+
+func csvCastToTimeFormatToTimeTzString(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	valTime, ok := value.(time.Time)
+	if !ok {
+		return ``, errors.New(`castToTimeFormatToTimeTzString unable to cast value to time`)
+	}
+	return valTime.Format("15:04:05.999999999-07:00"), nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
+)
+
+// ValidateCustomQueries checks the user supplied (target table, source query)
+// pairs. Each source query must be a single SELECT, optionally behind a CTE.
+func ValidateCustomQueries(v *validator.Validator, queries []Query, discover bool) {
+	if !discover {
+		v.Check(len(queries) > 0, "queries", "must be provided when discover_tables is false")
+	}
+
+	targets := make([]string, 0, len(queries))
+
+	for i, query := range queries {
+		key := fmt.Sprintf("queries[%d]", i)
+
+		v.Check(query.TargetTable != "", key+".target_table", "must be provided")
+		v.Check(len(query.TargetTable) <= 255, key+".target_table", "must not be more than 255 characters long")
+		v.Check(!strings.Contains(query.TargetTable, `"`), key+".target_table", "must not contain double quotes")
+
+		v.Check(query.SourceQuery != "", key+".source_query", "must be provided")
+		if query.SourceQuery != "" {
+			v.Check(isSelect(query.SourceQuery), key+".source_query", "must be a SELECT statement")
+		}
+
+		targets = append(targets, strings.ReplaceAll(strings.ToUpper(query.TargetTable), " ", "_"))
+	}
+
+	v.Check(validator.Unique(targets), "queries", "must not contain duplicate target tables")
+}
+
+func isSelect(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n;(")
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	first := strings.ToUpper(fields[0])
+	return first == "SELECT" || first == "WITH"
+}
+
+// Derivable reports whether query can be read as a derived table, as in
+// select ... from (query) as t. SQL Server allows neither a CTE there nor an
+// ORDER BY without TOP or OFFSET.
+func Derivable(query string) bool {
+	words := topLevelWords(query)
+	if len(words) > 0 && words[0] == "WITH" {
+		return false
+	}
+
+	orderBy, limited := false, false
+	for i, word := range words {
+		switch word {
+		case "TOP", "OFFSET":
+			limited = true
+		case "ORDER":
+			orderBy = orderBy || (i+1 < len(words) && words[i+1] == "BY")
+		}
+	}
+	return !orderBy || limited
+}
+
+// topLevelWords returns the upper cased words of query outside parentheses,
+// string literals and quoted identifiers.
+func topLevelWords(query string) []string {
+	words := []string{}
+	depth := 0
+	var quote rune
+	var word strings.Builder
+
+	endWord := func() {
+		if word.Len() > 0 {
+			words = append(words, strings.ToUpper(word.String()))
+			word.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			quote = ']'
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case depth == 0 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'):
+			word.WriteRune(r)
+			continue
+		}
+		endWord()
+	}
+	endWord()
+
+	return words
+}
+
+// TargetName returns the Snowflake table query is loaded into, quoted when
+// needed, along with the unquoted form used to name its S3 directory.
+func (query Query) TargetName() (quoted string, unquoted string) {
+	if query.TargetTable != "" {
+		name := strings.ReplaceAll(strings.ToUpper(query.TargetTable), " ", "_")
+		return QuoteIfTrue(name, HasNonAlnumOrSpace(name)), name
+	}
+
+	schema := strings.ReplaceAll(strings.ToUpper(query.Schema), " ", "_")
+	table := strings.ReplaceAll(strings.ToUpper(query.Table), " ", "_")
+	name := fmt.Sprintf(`%v_%v`, schema, table)
+
+	return QuoteIfTrue(name, HasNonAlnumOrSpace(schema) || HasNonAlnumOrSpace(table)), name
+}
@@ -0,0 +1,27 @@
+package data
+
+import "testing"
+
+func TestDerivable(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"select * from dbo.orders", true},
+		{"select * from dbo.orders with (nolock) where id > 5", true},
+		{";with recent as (select * from dbo.orders) select * from recent", false},
+		{"select * from dbo.orders order by id", false},
+		{"select top (10) * from dbo.orders order by id", true},
+		{"select * from dbo.orders order by id offset 0 rows", true},
+		{"select * from (select top 5 id from dbo.orders order by id) as o", true},
+		{"select row_number() over (order by id) as n from dbo.orders", true},
+		{"select 'order by' as [order by] from dbo.orders", true},
+	}
+
+	for _, tt := range tests {
+		got := Derivable(tt.query)
+		if got != tt.want {
+			t.Errorf("Derivable(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
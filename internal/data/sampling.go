@@ -0,0 +1,165 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
+)
+
+const DefaultSampleSchemaSuffix = "_DEV"
+
+var sampleSchemaSuffixRX = regexp.MustCompile(`^_[A-Za-z0-9_]+$`)
+
+// Sample loads a subset of every discovered table into schemas named with
+// SchemaSuffix, so a sampled transfer never writes to the prod schema. Rows
+// takes the first Rows rows of each table in primary key order; Percent
+// reads about that share of each table's pages with TABLESAMPLE, repeatably
+// for a given Seed. Custom queries are loaded as written.
+//
+// ForeignKeys names schema-qualified foreign keys whose referenced rows are
+// added to the sample of the referenced table, so each sampled row of the
+// referencing table finds its parent. Keys chain: a grandparent covers the
+// rows its parent's sample gained that way.
+type Sample struct {
+	Rows         int64    `json:"rows,omitempty"`
+	Percent      float64  `json:"percent,omitempty"`
+	Seed         int64    `json:"seed,omitempty"`
+	SchemaSuffix string   `json:"schema_suffix,omitempty"`
+	ForeignKeys  []string `json:"foreign_keys,omitempty"`
+}
+
+func ValidateSample(v *validator.Validator, sample *Sample) {
+	if sample == nil {
+		return
+	}
+
+	v.Check(sample.Rows >= 0, "sample.rows", "must not be negative")
+	v.Check(sample.Percent >= 0 && sample.Percent <= 100, "sample.percent", "must be between 0 and 100")
+	v.Check((sample.Rows > 0) != (sample.Percent > 0), "sample", "must set exactly one of rows or percent")
+	v.Check(sample.Seed >= 0, "sample.seed", "must not be negative")
+	v.Check(sample.SchemaSuffix == "" || validator.Matches(sample.SchemaSuffix, sampleSchemaSuffixRX), "sample.schema_suffix", "must start with an underscore and contain only letters, digits and underscores")
+
+	for _, name := range sample.ForeignKeys {
+		_, _, ok := SplitForeignKeyName(name)
+		v.Check(ok, "sample.foreign_keys", "must be schema-qualified names such as dbo.FK_Orders_Customers")
+	}
+	v.Check(validator.Unique(lowerAll(sample.ForeignKeys)), "sample.foreign_keys", "must not contain duplicate keys")
+}
+
+// Suffix returns the schema suffix, upper cased as Snowflake stores it.
+func (sample *Sample) Suffix() string {
+	if sample.SchemaSuffix == "" {
+		return DefaultSampleSchemaSuffix
+	}
+	return strings.ToUpper(sample.SchemaSuffix)
+}
+
+// SplitForeignKeyName splits schema.name at its first dot.
+func SplitForeignKeyName(name string) (string, string, bool) {
+	schema, key, ok := strings.Cut(name, ".")
+	return schema, key, ok && schema != "" && key != ""
+}
+
+// ForeignKey is a foreign key of the source, from the referencing table's
+// Columns to the referenced table's RefColumns.
+type ForeignKey struct {
+	Schema     string
+	Name       string
+	FromSchema string
+	FromTable  string
+	Columns    []string
+	ToSchema   string
+	ToTable    string
+	RefColumns []string
+}
+
+// SampleQuery builds the extraction query for table like SourceQuery,
+// reading only sample's share of it. orderBy, the primary key, makes a row
+// sample repeatable. TABLESAMPLE cannot read views or memory-optimized
+// tables, so a percent sample of those keeps the rows whose checksum falls in
+// that share instead.
+func (opts TableOptions) SampleQuery(table Query, columns []string, sample Sample, orderBy []string) string {
+	from := MssqlTableReference(table, "")
+
+	predicates := []string{}
+	if strings.TrimSpace(opts.Where) != "" {
+		predicates = append(predicates, fmt.Sprintf("(%v)", opts.Where))
+	}
+
+	top := ""
+	orderByClause := ""
+	if sample.Rows > 0 {
+		top = fmt.Sprintf("top (%v) ", sample.Rows)
+		if len(orderBy) > 0 {
+			orderByClause = " order by " + quoteMssqlIdentifiers(orderBy, "")
+		}
+	} else if table.View || table.MemoryOptimized {
+		predicates = append(predicates, fmt.Sprintf("abs(binary_checksum(*) %% 1000000) < %v", int64(sample.Percent*10000)))
+	} else {
+		seed := sample.Seed
+		if seed == 0 {
+			seed = 1
+		}
+		from = fmt.Sprintf("%v tablesample (%v percent) repeatable (%v)", from, strconv.FormatFloat(sample.Percent, 'f', -1, 64), seed)
+	}
+
+	projection := "*"
+	if len(columns) > 0 {
+		projection = quoteMssqlIdentifiers(columns, "")
+	}
+
+	query := fmt.Sprintf("select %v%v from %v", top, projection, from)
+	if len(predicates) > 0 {
+		query = fmt.Sprintf("%v where %v", query, strings.Join(predicates, " and "))
+	}
+
+	return query + orderByClause
+}
+
+// ClosureQuery selects from table the rows of its own sample, matched on
+// key, along with every row a referencing sample points to. sampled builds
+// the table's own sample with the given projection; each referencing sample
+// is paired with the foreign key it reaches the table through.
+func ClosureQuery(table Query, columns []string, key []string, sampled func(columns []string) string, referencing []ForeignKey, referencingSamples []func(columns []string) string) string {
+	projection := "sqlpipe_t.*"
+	if len(columns) > 0 {
+		projection = quoteMssqlIdentifiers(columns, "sqlpipe_t.")
+	}
+
+	conditions := []string{
+		fmt.Sprintf("exists (select 1 from (%v) as sqlpipe_s where %v)", sampled(key), joinColumns("sqlpipe_s.", key, "sqlpipe_t.", key)),
+	}
+	for i, fk := range referencing {
+		conditions = append(conditions, fmt.Sprintf(
+			"exists (select 1 from (%v) as sqlpipe_r where %v)",
+			referencingSamples[i](fk.Columns),
+			joinColumns("sqlpipe_r.", fk.Columns, "sqlpipe_t.", fk.RefColumns),
+		))
+	}
+
+	return fmt.Sprintf(
+		"select %v from %v where %v",
+		projection,
+		MssqlTableReference(table, "sqlpipe_t"),
+		strings.Join(conditions, " or "),
+	)
+}
+
+func quoteMssqlIdentifiers(names []string, prefix string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = prefix + QuoteMssqlIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func joinColumns(leftPrefix string, left []string, rightPrefix string, right []string) string {
+	conditions := make([]string, len(left))
+	for i := range left {
+		conditions[i] = fmt.Sprintf("%v%v = %v%v", leftPrefix, QuoteMssqlIdentifier(left[i]), rightPrefix, QuoteMssqlIdentifier(right[i]))
+	}
+	return strings.Join(conditions, " and ")
+}
@@ -1,24 +1,189 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 
 	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
 )
 
+const (
+	SourceTypeMssql      = "mssql"
+	SourceTypePostgresql = "postgresql"
+)
+
+// Source authentication methods. NTLM logs in as Domain\Username, which is
+// how Windows integrated authentication works from a non-Windows host.
+const (
+	SourceAuthSql                     = "sql"
+	SourceAuthNtlm                    = "ntlm"
+	SourceAuthAzureAdPassword         = "azure_ad_password"
+	SourceAuthAzureAdServicePrincipal = "azure_ad_service_principal"
+	SourceAuthAzureAdManagedIdentity  = "azure_ad_managed_identity"
+	SourceAuthAzureAdDefault          = "azure_ad_default"
+)
+
 type Source struct {
-	Host     string  `json:"source_host"`
-	Port     int     `json:"source_port"`
-	Username string  `json:"source_username"`
-	Password string  `json:"password"`
-	DbName   string  `json:"source_db_name"`
-	Db       *sql.DB `json:"source_db"`
+	Type                   string  `json:"source_type"`
+	Host                   string  `json:"source_host"`
+	Port                   int     `json:"source_port"`
+	Instance               string  `json:"source_instance"`
+	Username               string  `json:"source_username"`
+	Password               string  `json:"password"`
+	DbName                 string  `json:"source_db_name"`
+	Authentication         string  `json:"source_authentication"`
+	Domain                 string  `json:"source_domain"`
+	TenantId               string  `json:"source_tenant_id"`
+	ClientId               string  `json:"source_client_id"`
+	Encrypt                string  `json:"source_encrypt"`
+	TrustServerCertificate *bool   `json:"source_trust_server_certificate"`
+	Certificate            string  `json:"source_certificate"`
+	HostNameInCertificate  string  `json:"source_host_name_in_certificate"`
+	ApplicationIntent      string  `json:"source_application_intent"`
+	MultiSubnetFailover    bool    `json:"source_multi_subnet_failover"`
+	ConnectionTimeout      int     `json:"source_connection_timeout"`
+	DialTimeout            int     `json:"source_dial_timeout"`
+	Db                     *sql.DB `json:"source_db"`
+}
+
+// Queryer runs read queries. *sql.DB, *sql.Conn and *sql.Tx all satisfy it.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// SourceDriver is what a transfer needs to know about one kind of source
+// database to discover its tables and load them into Snowflake.
+type SourceDriver interface {
+	// Name tags the prod schema and SP_GRANT_SCHEMA_ACCESS call.
+	Name() string
+	Open(source *Source) (*sql.DB, error)
+	QuoteIdentifier(name string) string
+	// DiscoverTables lists the user tables, largest first.
+	DiscoverTables(ctx context.Context, db Queryer) ([]Query, error)
+	// TableColumns lists the columns of schema.table in ordinal order.
+	TableColumns(ctx context.Context, db Queryer, schema, table string) ([]string, error)
+	// SnowflakeType maps a column's database type name, as reported by the
+	// driver's sql.ColumnType, to the Snowflake type it is created as.
+	SnowflakeType(dbType string, precision, scale int64) (string, error)
+	// Formatter returns the function that writes values of dbType to CSV.
+	Formatter(dbType string) (func(value interface{}) (string, error), bool)
+}
+
+func (source *Source) Driver() SourceDriver {
+	if source.Type == SourceTypePostgresql {
+		return postgresqlDriver{}
+	}
+	return mssqlDriver{}
+}
+
+func (source *Source) Open() (*sql.DB, error) {
+	return source.Driver().Open(source)
 }
 
 func ValidateSource(v *validator.Validator, source Source) {
+	v.Check(validator.PermittedValue(source.Type, "", SourceTypeMssql, SourceTypePostgresql), "source_type", "must be mssql or postgresql")
 	v.Check(source.Host != "", "source_host", "must be provided")
-	v.Check(source.Port != 0, "source_port", "must be provided")
-	v.Check(source.Username != "", "source_username", "must be provided")
-	v.Check(source.Password != "", "source_password", "must be provided")
 	v.Check(source.DbName != "", "source_db_name", "must be provided")
+	v.Check(source.ConnectionTimeout >= 0, "source_connection_timeout", "must not be negative")
+
+	if source.Type == SourceTypePostgresql {
+		validatePostgresqlSource(v, source)
+		return
+	}
+
+	v.Check(source.Port != 0 || source.Instance != "", "source_port", "must be provided unless source_instance is")
+	v.Check(source.Port >= 0 && source.Port <= 65535, "source_port", "must be between 1 and 65535")
+	v.Check(source.Port == 0 || source.Instance == "", "source_instance", "cannot be combined with source_port, which would take precedence")
+
+	v.Check(
+		validator.PermittedValue(
+			source.Authentication,
+			"",
+			SourceAuthSql,
+			SourceAuthNtlm,
+			SourceAuthAzureAdPassword,
+			SourceAuthAzureAdServicePrincipal,
+			SourceAuthAzureAdManagedIdentity,
+			SourceAuthAzureAdDefault,
+		),
+		"source_authentication",
+		"must be sql, ntlm, azure_ad_password, azure_ad_service_principal, azure_ad_managed_identity or azure_ad_default",
+	)
+
+	switch source.Authentication {
+	case "", SourceAuthSql, SourceAuthAzureAdPassword:
+		v.Check(source.Username != "", "source_username", "must be provided")
+		v.Check(source.Password != "", "source_password", "must be provided")
+	case SourceAuthNtlm:
+		v.Check(source.Domain != "", "source_domain", "must be provided")
+		v.Check(source.Username != "", "source_username", "must be provided")
+		v.Check(source.Password != "", "source_password", "must be provided")
+	case SourceAuthAzureAdServicePrincipal:
+		v.Check(source.Password != "", "source_password", "must be provided as the client secret")
+	}
+
+	switch source.Authentication {
+	case SourceAuthAzureAdPassword, SourceAuthAzureAdServicePrincipal:
+		v.Check(source.ClientId != "", "source_client_id", "must be provided")
+	case SourceAuthAzureAdManagedIdentity:
+	default:
+		v.Check(source.ClientId == "", "source_client_id", "only applies to azure_ad_password, azure_ad_service_principal and azure_ad_managed_identity")
+	}
+
+	v.Check(source.Domain == "" || source.Authentication == SourceAuthNtlm, "source_domain", "only applies to ntlm authentication")
+	v.Check(source.TenantId == "" || source.azureAd(), "source_tenant_id", "only applies to azure_ad authentication")
+
+	v.Check(validator.PermittedValue(strings.ToLower(source.Encrypt), "", "true", "false", "disable"), "source_encrypt", "must be true, false or disable")
+	v.Check(source.Certificate == "" || !strings.EqualFold(source.Encrypt, "disable"), "source_certificate", "cannot be used when encryption is disabled")
+	v.Check(source.Certificate == "" || source.TrustServerCertificate == nil || !*source.TrustServerCertificate, "source_certificate", "cannot be combined with source_trust_server_certificate")
+	v.Check(validator.PermittedValue(source.ApplicationIntent, "", "ReadWrite", "ReadOnly"), "source_application_intent", "must be ReadWrite or ReadOnly")
+	v.Check(source.DialTimeout >= 0, "source_dial_timeout", "must not be negative")
+}
+
+func (source *Source) azureAd() bool {
+	return strings.HasPrefix(source.Authentication, "azure_ad_")
+}
+
+// SelectQuery selects columns, or every column when there are none, from
+// schema.table.
+func SelectQuery(driver SourceDriver, schema, table string, columns []string) string {
+	projection := "*"
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = driver.QuoteIdentifier(column)
+		}
+		projection = strings.Join(quoted, ", ")
+	}
+
+	return fmt.Sprintf("select %v from %v.%v", projection, driver.QuoteIdentifier(schema), driver.QuoteIdentifier(table))
+}
+
+// queryColumns runs a query, with schema and table as its parameters, that
+// returns one column name per row.
+func queryColumns(ctx context.Context, db Queryer, query, schema, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("error querying columns of %v.%v: %v", schema, table, err)
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var column string
+		err := rows.Scan(&column)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning column of %v.%v: %v", schema, table, err)
+		}
+		columns = append(columns, column)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating over columns of %v.%v: %v", schema, table, err)
+	}
+
+	return columns, nil
 }
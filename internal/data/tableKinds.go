@@ -0,0 +1,46 @@
+package data
+
+import "fmt"
+
+const (
+	TemporalSystemVersioned = "system_versioned"
+	TemporalHistory         = "history"
+)
+
+const (
+	ComputedColumnsValues = "values"
+	ComputedColumnsSkip   = "skip"
+)
+
+// CatalogColumn is a column of a table that has computed, hidden period or
+// sparse column set columns, which SELECT * does not read as plain columns.
+type CatalogColumn struct {
+	Name      string
+	Computed  bool
+	ColumnSet bool
+	Hidden    bool
+}
+
+// ProjectColumns picks which of a table's columns to extract, along with a
+// note for each column left out. A sparse column set is never extracted, as
+// its sparse columns are read individually. Hidden period columns are read
+// when periodColumns is set, and computed columns unless computed is skip.
+func ProjectColumns(columns []CatalogColumn, periodColumns bool, computed string) ([]string, []string) {
+	projection := []string{}
+	notes := []string{}
+
+	for _, column := range columns {
+		switch {
+		case column.ColumnSet:
+			notes = append(notes, fmt.Sprintf("column set %v is not extracted; its sparse columns are", column.Name))
+		case column.Hidden && !periodColumns:
+			notes = append(notes, fmt.Sprintf("hidden period column %v is not extracted", column.Name))
+		case column.Computed && computed == ComputedColumnsSkip:
+			notes = append(notes, fmt.Sprintf("computed column %v is skipped", column.Name))
+		default:
+			projection = append(projection, column.Name)
+		}
+	}
+
+	return projection, notes
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
+)
+
+const (
+	ModeFull           = "full"
+	ModeIncremental    = "incremental"
+	ModeChangeTracking = "change_tracking"
+	ModeCdc            = "cdc"
+)
+
+// TableOptions narrows what is extracted from one discovered table. Where is
+// a T-SQL predicate and Columns an explicit projection; either may be empty.
+// In incremental mode only rows past the stored watermark are extracted and
+// merged into the prod table on KeyColumns, which default to the primary key.
+// In change_tracking mode the changes SQL Server recorded since the last run
+// are read from CHANGETABLE and merged and deleted on the primary key. In cdc
+// mode rows from the capture instance's change function are appended to a
+// change log table and, with ApplyChanges, merged into a current-state table.
+//
+// Full and incremental tables can be read in parallel: in Partitions ranges
+// of an integer key, or one read per partition with PartitionBy "native".
+type TableOptions struct {
+	Schema          string   `json:"schema"`
+	Table           string   `json:"table"`
+	Where           string   `json:"where"`
+	Columns         []string `json:"columns"`
+	Mode            string   `json:"mode"`
+	WatermarkColumn string   `json:"watermark_column"`
+	KeyColumns      []string `json:"key_columns"`
+	CaptureInstance string   `json:"capture_instance"`
+	ApplyChanges    bool     `json:"apply_changes"`
+	Partitions      int      `json:"partitions"`
+	PartitionBy     string   `json:"partition_by"`
+	PartitionColumn string   `json:"partition_column"`
+}
+
+func ValidateTableOptions(v *validator.Validator, options []TableOptions) {
+	names := make([]string, 0, len(options))
+
+	for i, opts := range options {
+		key := fmt.Sprintf("tables[%d]", i)
+
+		v.Check(opts.Schema != "", key+".schema", "must be provided")
+		v.Check(opts.Table != "", key+".table", "must be provided")
+		v.Check(!strings.Contains(opts.Where, ";"), key+".where", "must be a single predicate without semicolons")
+
+		for _, column := range opts.Columns {
+			v.Check(column != "", key+".columns", "must not contain empty names")
+		}
+		v.Check(validator.Unique(lowerAll(opts.Columns)), key+".columns", "must not contain duplicate columns")
+
+		v.Check(validator.PermittedValue(opts.Mode, "", ModeFull, ModeIncremental, ModeChangeTracking, ModeCdc), key+".mode", "must be full, incremental, change_tracking or cdc")
+		if opts.Mode == ModeChangeTracking || opts.Mode == ModeCdc {
+			v.Check(strings.TrimSpace(opts.Where) == "", key+".where", "cannot be used in "+opts.Mode+" mode")
+		}
+		if opts.Mode == ModeIncremental {
+			v.Check(opts.WatermarkColumn != "", key+".watermark_column", "must be provided in incremental mode")
+		} else {
+			v.Check(opts.WatermarkColumn == "", key+".watermark_column", "only applies in incremental mode")
+		}
+		if opts.Mode != ModeIncremental && opts.Mode != ModeCdc {
+			v.Check(len(opts.KeyColumns) == 0, key+".key_columns", "only applies in incremental and cdc modes")
+		}
+		if opts.Mode != ModeCdc {
+			v.Check(opts.CaptureInstance == "", key+".capture_instance", "only applies in cdc mode")
+			v.Check(!opts.ApplyChanges, key+".apply_changes", "only applies in cdc mode")
+		}
+		for _, column := range opts.KeyColumns {
+			v.Check(column != "", key+".key_columns", "must not contain empty names")
+		}
+
+		v.Check(opts.Partitions >= 0 && opts.Partitions <= 1000, key+".partitions", "must be between 0 and 1000")
+		v.Check(validator.PermittedValue(opts.PartitionBy, "", PartitionByKey, PartitionByNative), key+".partition_by", "must be key or native")
+		if opts.PartitionBy == PartitionByNative {
+			v.Check(opts.Partitions == 0, key+".partitions", "does not apply when partition_by is native")
+			v.Check(opts.PartitionColumn == "", key+".partition_column", "does not apply when partition_by is native")
+		}
+		if opts.Partitions > 1 || opts.PartitionBy != "" {
+			v.Check(validator.PermittedValue(opts.Mode, "", ModeFull, ModeIncremental), key+".partitions", "only applies in full and incremental modes")
+		}
+
+		names = append(names, strings.ToLower(opts.Schema+"."+opts.Table))
+	}
+
+	v.Check(validator.Unique(names), "tables", "must not list the same table twice")
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
+}
+
+// Matches reports whether opts applies to schema.table, ignoring case as
+// SQL Server's default collation does.
+func (opts TableOptions) Matches(schema, table string) bool {
+	return strings.EqualFold(opts.Schema, schema) && strings.EqualFold(opts.Table, table)
+}
+
+// SourceQuery builds the extraction query for table. columns must already be
+// resolved to their names in the source catalog.
+func (opts TableOptions) SourceQuery(driver SourceDriver, table Query, columns []string) string {
+	query := SelectQuery(driver, table.Schema, table.Table, columns)
+	if table.TableHint != "" {
+		query = fmt.Sprintf("%v with (%v)", query, table.TableHint)
+	}
+	if strings.TrimSpace(opts.Where) != "" {
+		query = fmt.Sprintf("%v where (%v)", query, opts.Where)
+	}
+
+	return query
+}
+
+// MssqlTableReference returns the table a query reads, aliased when alias
+// is set and followed by its table hint, for use in a FROM clause.
+func MssqlTableReference(table Query, alias string) string {
+	reference := fmt.Sprintf("%v.%v", QuoteMssqlIdentifier(table.Schema), QuoteMssqlIdentifier(table.Table))
+	if alias != "" {
+		reference = fmt.Sprintf("%v as %v", reference, alias)
+	}
+	if table.TableHint != "" {
+		reference = fmt.Sprintf("%v with (%v)", reference, table.TableHint)
+	}
+	return reference
+}
+
+func QuoteMssqlIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
@@ -2,8 +2,14 @@ package data
 
 import (
 	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
 
+	"github.com/snowflakedb/gosnowflake"
 	"github.com/sqlpipe/mssqltosnowflake/internal/validator"
 )
 
@@ -38,3 +44,67 @@ func ValidateTarget(v *validator.Validator, target Target) {
 	// v.Check(target.ServerName != "", "server_name", "must be provided")
 	// v.Check(target.FileFormatName != "", "target_file_format_name", "must be provided")
 }
+
+// ValidateTargetConnection checks only the fields needed to log in to
+// Snowflake, for callers that never load data.
+func ValidateTargetConnection(v *validator.Validator, target Target) {
+	v.Check(target.AccountId != "", "target_account_id", "must be provided")
+	v.Check(target.PrivateKeyLocation != "", "target_private_key_location", "must be provided")
+	v.Check(target.Role != "", "target_role", "must be provided")
+	v.Check(target.Warehouse != "", "target_warehouse", "must be provided")
+	v.Check(target.Username != "", "target_username", "must be provided")
+	v.Check(target.DbName != "", "target_db_name", "must be provided")
+}
+
+func ReadPrivateKey(location string) (*rsa.PrivateKey, error) {
+	priv, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key file, err: %v", err)
+	}
+
+	privPem, _ := pem.Decode(priv)
+	if privPem == nil || len(privPem.Bytes) == 0 {
+		return nil, errors.New("unable to read private key pem bytes")
+	}
+
+	var parsedKey interface{}
+	if parsedKey, err = x509.ParsePKCS1PrivateKey(privPem.Bytes); err != nil {
+		if parsedKey, err = x509.ParsePKCS8PrivateKey(privPem.Bytes); err != nil {
+			return nil, fmt.Errorf("unable to parse private key pem bytes, err: %v", err)
+		}
+	}
+
+	privKey, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("unable to assert privkey to *rsa.PrivateKey")
+	}
+
+	return privKey, nil
+}
+
+// Open returns a Snowflake connection pool authenticated with the target's
+// private key. An empty schema leaves the session without a current schema.
+func (target *Target) Open(schema string) (*sql.DB, error) {
+	snowflakeConfig := gosnowflake.Config{
+		Account:       target.AccountId,
+		User:          target.Username,
+		Database:      target.DbName,
+		Warehouse:     target.Warehouse,
+		Role:          target.Role,
+		Authenticator: gosnowflake.AuthTypeJwt,
+		PrivateKey:    &target.PrivateKey,
+		Schema:        schema,
+	}
+
+	targetDsn, err := gosnowflake.DSN(&snowflakeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct a snowflake DSN, err: %v", err)
+	}
+
+	targetDb, err := sql.Open("snowflake", targetDsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open a connection to snowflake, err: %v", err)
+	}
+
+	return targetDb, nil
+}
@@ -0,0 +1,269 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+// TransferModel is the store of transfers. Handlers and the background
+// transfer goroutines share it, so every access goes through its lock. With a
+// directory, each transfer's record is saved to <id>.json and its log entries
+// are appended to <id>.log, so both survive a restart of the server.
+type TransferModel struct {
+	mu        sync.RWMutex
+	transfers map[string]Transfer
+	dir       string
+	logFiles  map[string]*os.File
+
+	errMu sync.Mutex
+	err   error
+}
+
+// NewTransferModel returns a store that persists to dir, or keeps transfers
+// in memory only when dir is empty.
+func NewTransferModel(dir string) *TransferModel {
+	return &TransferModel{
+		transfers: make(map[string]Transfer),
+		dir:       dir,
+		logFiles:  make(map[string]*os.File),
+	}
+}
+
+// Load reads the transfers saved in the store's directory, creating it if
+// needed. Transfers that were still running when the server stopped are
+// marked failed.
+func (m *TransferModel) Load(logLines int) (int, error) {
+	if m.dir == "" {
+		return 0, nil
+	}
+
+	err := os.MkdirAll(m.dir, 0o700)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create transfer directory: %v", err)
+	}
+
+	files, err := os.ReadDir(m.dir)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read transfer directory: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		contents, err := os.ReadFile(filepath.Join(m.dir, file.Name()))
+		if err != nil {
+			return 0, fmt.Errorf("unable to read transfer %v: %v", file.Name(), err)
+		}
+
+		var transfer Transfer
+		err = json.Unmarshal(contents, &transfer)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse transfer %v: %v", file.Name(), err)
+		}
+
+		transfer.Logs = jsonlog.NewBuffer(logLines, jsonlog.LevelDebug)
+		logFile, err := os.Open(m.logPath(transfer.Id))
+		if err == nil {
+			err = transfer.Logs.Restore(logFile)
+			logFile.Close()
+			if err != nil {
+				return 0, fmt.Errorf("unable to restore logs of transfer %v: %v", transfer.Id, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("unable to open logs of transfer %v: %v", transfer.Id, err)
+		}
+
+		if transfer.Status == "running" {
+			transfer.Status = "failed"
+			transfer.Error = "the server stopped while the transfer was running"
+			err = m.save(transfer)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		m.transfers[transfer.Id] = transfer
+	}
+
+	return len(m.transfers), nil
+}
+
+func (m *TransferModel) Insert(transfer Transfer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.transfers[transfer.Id] = transfer
+
+	if m.dir == "" {
+		return
+	}
+
+	m.recordErr(m.save(transfer))
+
+	logFile, err := os.OpenFile(m.logPath(transfer.Id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		m.recordErr(fmt.Errorf("unable to open logs of transfer %v: %v", transfer.Id, err))
+		return
+	}
+	m.logFiles[transfer.Id] = logFile
+	transfer.Logs.PersistTo(transferLogWriter{id: transfer.Id, file: logFile, model: m})
+}
+
+// Get returns a copy of the transfer that is safe to read while the transfer
+// is still running.
+func (m *TransferModel) Get(id string) (Transfer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transfer, ok := m.transfers[id]
+	if !ok {
+		return Transfer{}, false
+	}
+
+	transfer.Queries = append([]Query(nil), transfer.Queries...)
+
+	return transfer, true
+}
+
+// Update applies fn to the stored transfer under the store's lock. It
+// reports whether a transfer with that id exists.
+func (m *TransferModel) Update(id string, fn func(transfer *Transfer)) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transfer, ok := m.transfers[id]
+	if !ok {
+		return false
+	}
+
+	fn(&transfer)
+	m.transfers[id] = transfer
+
+	if m.dir == "" {
+		return true
+	}
+
+	m.recordErr(m.save(transfer))
+
+	logFile, ok := m.logFiles[id]
+	if ok && transfer.Status != "running" {
+		transfer.Logs.PersistTo(nil)
+		m.recordErr(logFile.Close())
+		delete(m.logFiles, id)
+	}
+
+	return true
+}
+
+func (m *TransferModel) CountByStatus(status string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, transfer := range m.transfers {
+		if transfer.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Ping reports whether the store can be read before ctx expires, which
+// catches a store wedged behind a stuck writer, and whether the last write to
+// its directory failed.
+func (m *TransferModel) Ping(ctx context.Context) error {
+	acquired := make(chan struct{})
+
+	go func() {
+		m.mu.RLock()
+		m.mu.RUnlock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+	case <-ctx.Done():
+		return fmt.Errorf("unable to read transfer store: %v", ctx.Err())
+	}
+
+	m.errMu.Lock()
+	defer m.errMu.Unlock()
+
+	return m.err
+}
+
+// save writes the transfer's record to a temporary file and renames it into
+// place, so a crash never leaves a partly written record.
+func (m *TransferModel) save(transfer Transfer) error {
+	contents, err := json.Marshal(transfer)
+	if err != nil {
+		return fmt.Errorf("unable to encode transfer %v: %v", transfer.Id, err)
+	}
+
+	path := filepath.Join(m.dir, transfer.Id+".json")
+	tmp, err := os.CreateTemp(m.dir, transfer.Id+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to save transfer %v: %v", transfer.Id, err)
+	}
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("unable to save transfer %v: %v", transfer.Id, err)
+	}
+
+	return nil
+}
+
+func (m *TransferModel) logPath(id string) string {
+	return filepath.Join(m.dir, id+".log")
+}
+
+// recordErr keeps the latest persistence error for Ping. A later successful
+// write does not clear it, as the failed write's data is still missing.
+func (m *TransferModel) recordErr(err error) {
+	if err == nil {
+		return
+	}
+
+	m.errMu.Lock()
+	defer m.errMu.Unlock()
+
+	m.err = err
+}
+
+// transferLogWriter appends a transfer's log entries to its log file,
+// recording write errors for Ping.
+type transferLogWriter struct {
+	id    string
+	file  *os.File
+	model *TransferModel
+}
+
+func (w transferLogWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	if err != nil {
+		w.model.recordErr(fmt.Errorf("unable to write logs of transfer %v: %v", w.id, err))
+	}
+	return n, err
+}
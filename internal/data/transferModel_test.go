@@ -0,0 +1,64 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
+)
+
+func TestTransferModelRestoresRecordsAndLogs(t *testing.T) {
+	dir := t.TempDir()
+
+	transfers := NewTransferModel(dir)
+	_, err := transfers.Load(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"done", "interrupted"} {
+		logs := jsonlog.NewBuffer(10, jsonlog.LevelDebug)
+		transfers.Insert(Transfer{Id: id, Status: "running", Logs: logs})
+		logger := jsonlog.New(&bytes.Buffer{}, jsonlog.LevelDebug).WithBuffer(logs)
+		logger.PrintInfo("starting "+id, nil)
+		logger.PrintWarn("warning "+id, nil)
+	}
+	transfers.Update("done", func(transfer *Transfer) {
+		transfer.Status = "complete"
+	})
+
+	err = transfers.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewTransferModel(dir)
+	loaded, err := restored.Load(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != 2 {
+		t.Fatalf("loaded %v transfers, want 2", loaded)
+	}
+
+	done, ok := restored.Get("done")
+	if !ok || done.Status != "complete" {
+		t.Fatalf("got transfer %+v, want a complete transfer", done)
+	}
+	interrupted, ok := restored.Get("interrupted")
+	if !ok || interrupted.Status != "failed" || interrupted.Error == "" {
+		t.Fatalf("got transfer %+v, want a failed transfer", interrupted)
+	}
+
+	entries := done.Logs.Entries(jsonlog.LevelDebug, 0, 0)
+	if len(entries) != 1 || entries[0].Message != "warning done" || entries[0].Seq != 2 {
+		t.Errorf("got entries %+v, want only the last one", entries)
+	}
+	if done.Logs.Dropped() != 1 {
+		t.Errorf("got %v dropped entries, want 1", done.Logs.Dropped())
+	}
+	if len(done.Logs.Entries(jsonlog.LevelWarn, 0, 0)) != 1 {
+		t.Error("restored entries lost their level")
+	}
+}
@@ -15,9 +15,17 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/sqlpipe/mssqltosnowflake/internal/jsonlog"
 	"github.com/sqlpipe/mssqltosnowflake/pkg"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
 )
 
+var tracer = otel.Tracer("github.com/sqlpipe/mssqltosnowflake/internal/data")
+
 func HasNonAlnumOrSpace(word string) bool {
 	regex := regexp.MustCompile(`^[a-zA-Z0-9]+$`)
 	for _, charCode := range word {
@@ -39,12 +47,37 @@ func QuoteIfTrue(word string, hasNonAlnum bool) string {
 var snowflakeReservedKeywords = map[string]bool{"ACCOUNT": true, "ALL": true, "ALTER": true, "AND": true, "ANY": true, "AS": true, "BETWEEN": true, "BY": true, "CASE": true, "CAST": true, "CHECK": true, "COLUMN": true, "CONNECT": true, "CONNECTION": true, "CONSTRAINT": true, "CREATE": true, "CROSS": true, "CURRENT": true, "CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true, "CURRENT_USER": true, "DATABASE": true, "DELETE": true, "DISTINCT": true, "DROP": true, "ELSE": true, "EXISTS": true, "FALSE": true, "FOLLOWING": true, "FOR": true, "FROM": true, "FULL": true, "GRANT": true, "GROUP": true, "GSCLUSTER": true, "HAVING": true, "ILIKE": true, "IN": true, "INCREMENT": true, "INNER": true, "INSERT": true, "INTERSECT": true, "INTO": true, "IS": true, "ISSUE": true, "JOIN": true, "LATERAL": true, "LEFT": true, "LIKE": true, "LOCALTIME": true, "LOCALTIMESTAMP": true, "MINUS": true, "NATURAL": true, "NOT": true, "NULL": true, "OF": true, "ON": true, "OR": true, "ORDER": true, "ORGANIZATION": true, "QUALIFY": true, "REGEXP": true, "REVOKE": true, "RIGHT": true, "RLIKE": true, "ROW": true, "ROWS": true, "SAMPLE": true, "SCHEMA": true, "SELECT": true, "SET": true, "SOME": true, "START": true, "TABLE": true, "TABLESAMPLE": true, "THEN": true, "TO": true, "TRIGGER": true, "TRUE": true, "TRY_CAST": true, "UNION": true, "UNIQUE": true, "UPDATE": true, "USING": true, "VALUES": true, "VIEW": true, "WHEN": true, "WHENEVER": true, "WHERE": true, "WITH": true}
 
 type Query struct {
-	Schema                 string `json:"source_schema"`
-	Table                  string `json:"source_table"`
-	SourceQuery            string `json:"source_query"`
-	S3Path                 string `json:"s3_path"`
-	TargetCreateTableQuery string `json:"target_create_table_query"`
-	TargetQuery            string `json:"target_query"`
+	Schema                 string           `json:"source_schema"`
+	Table                  string           `json:"source_table"`
+	TargetTable            string           `json:"target_table,omitempty"`
+	SourceQuery            string           `json:"source_query"`
+	Columns                []string         `json:"columns,omitempty"`
+	Mode                   string           `json:"mode,omitempty"`
+	WatermarkColumn        string           `json:"watermark_column,omitempty"`
+	KeyColumns             []string         `json:"key_columns,omitempty"`
+	CaptureInstance        string           `json:"capture_instance,omitempty"`
+	ApplyChanges           bool             `json:"apply_changes,omitempty"`
+	SizeMB                 int64            `json:"size_mb,omitempty"`
+	Partitions             int              `json:"partitions,omitempty"`
+	PartitionBy            string           `json:"partition_by,omitempty"`
+	PartitionColumn        string           `json:"partition_column,omitempty"`
+	AutoSplit              bool             `json:"auto_split,omitempty"`
+	View                   bool             `json:"view,omitempty"`
+	ViewDefinition         string           `json:"-"`
+	Temporal               string           `json:"temporal,omitempty"`
+	HistorySchema          string           `json:"-"`
+	HistoryTable           string           `json:"-"`
+	MemoryOptimized        bool             `json:"memory_optimized,omitempty"`
+	TableHint              string           `json:"table_hint,omitempty"`
+	Notes                  []string         `json:"notes,omitempty"`
+	RowsExtracted          int64            `json:"rows_extracted"`
+	RowsLoaded             int64            `json:"rows_loaded"`
+	RowsInStaging          int64            `json:"rows_in_staging"`
+	Validation             *TableValidation `json:"validation,omitempty"`
+	UnsupportedDefaults    []string         `json:"unsupported_defaults,omitempty"`
+	S3Path                 string           `json:"s3_path"`
+	TargetCreateTableQuery string           `json:"target_create_table_query"`
+	TargetQuery            string           `json:"target_query"`
 }
 
 type ColumnInfo struct {
@@ -52,106 +85,89 @@ type ColumnInfo struct {
 	ColumnDbTypes       []string
 	ColumnScanTypes     []reflect.Type
 	ColumnNamesAndTypes []string
+	ColumnTargetTypes   []string
+	ColumnNullables     []bool
+	ColumnDefaults      []string
 	ColumnPrecisions    []int64
 	ColumnScales        []int64
 	ColumnLengths       []int64
+	TargetColumnNames   []string
 	NumCols             int
 }
 
+const (
+	ConsistencyNone     = "none"
+	ConsistencySnapshot = "snapshot"
+)
+
+const (
+	RowCountMismatchFail = "fail"
+	RowCountMismatchWarn = "warn"
+)
+
 type Transfer struct {
-	Id          string    `json:"transfer_id"`
-	CreatedAt   time.Time `json:"transfer_created_at"`
-	Concurrency int       `json:"concurrency"`
-	Source      *Source   `json:"-"`
-	Target      *Target   `json:"-"`
-	AwsConfig   AwsConfig `json:"-"`
-	Queries     []Query   `json:"transfer_queries"`
-	Status      string    `json:"transfer_status"`
-	Error       string    `json:"transfer_error"`
+	Id                 string              `json:"transfer_id"`
+	CreatedAt          time.Time           `json:"transfer_created_at"`
+	Concurrency        int                 `json:"concurrency"`
+	Source             *Source             `json:"-"`
+	Target             *Target             `json:"-"`
+	AwsConfig          AwsConfig           `json:"-"`
+	Filter             TableFilter         `json:"-"`
+	TableOptions       []TableOptions      `json:"-"`
+	Discover           bool                `json:"discover_tables"`
+	CustomQueries      []Query             `json:"-"`
+	Queries            []Query             `json:"transfer_queries"`
+	SkippedTables      []SkippedTable      `json:"skipped_tables"`
+	Status             string              `json:"transfer_status"`
+	Error              string              `json:"transfer_error"`
+	Logs               *jsonlog.Buffer     `json:"-"`
+	SplitOverMB        int64               `json:"split_tables_over_mb,omitempty"`
+	SplitRanges        int                 `json:"split_ranges,omitempty"`
+	Consistency        string              `json:"consistency,omitempty"`
+	OnRowCountMismatch string              `json:"on_row_count_mismatch,omitempty"`
+	Views              string              `json:"views,omitempty"`
+	TranslatedViews    []ViewReport        `json:"translated_views,omitempty"`
+	ValidateChecksums  bool                `json:"validate_checksums,omitempty"`
+	Sample             *Sample             `json:"sample,omitempty"`
+	PeriodColumns      bool                `json:"temporal_period_columns,omitempty"`
+	ComputedColumns    string              `json:"computed_columns,omitempty"`
+	Constraints        []ConstraintReport  `json:"constraints,omitempty"`
+	SourceReader       Queryer             `json:"-"`
+	SourceReads        *semaphore.Weighted `json:"-"`
+}
+
+// SnowflakeColumnName returns the name a source column gets in Snowflake.
+func SnowflakeColumnName(colName string) string {
+	colName = strings.ToUpper(colName)
+
+	// colHasNonAlnum := hasNonAlnum(colName)
+
+	// colName = quoteIfTrue(colName, colHasNonAlnum)
+
+	// check for snowflake reserved keywords or numbers being the first character or non alphanumeric chars
+	if snowflakeReservedKeywords[colName] || !unicode.IsLetter(rune(colName[0])) || HasNonAlnumOrSpace(colName) {
+		colName = fmt.Sprintf(`"%v"`, colName)
+	}
+
+	return colName
 }
 
-func GetCreateTableTypes(columnInfo ColumnInfo) (ColumnInfo, error) {
+func GetCreateTableTypes(driver SourceDriver, columnInfo ColumnInfo) (ColumnInfo, error) {
 
 	for colNum := range columnInfo.ColumnDbTypes {
 
 		colName := columnInfo.ColumnNames[colNum]
 		dbType := columnInfo.ColumnDbTypes[colNum]
 
-		createType := ""
-
-		switch dbType {
-		case "BIGINT":
-			createType = "BIGINT"
-		case "BIT":
-			createType = "BOOLEAN"
-		case "INT":
-			createType = "INT"
-		case "MONEY":
-			createType = "TEXT"
-		case "SMALLINT":
-			createType = "SMALLINT"
-		case "SMALLMONEY":
-			createType = "TEXT"
-		case "TINYINT":
-			createType = "TINYINT"
-		case "FLOAT":
-			createType = "FLOAT"
-		case "REAL":
-			createType = "FLOAT"
-		case "DATE":
-			createType = "DATE"
-		case "DATETIME2":
-			createType = "TIMESTAMP"
-		case "DATETIME":
-			createType = "TIMESTAMP"
-		case "DATETIMEOFFSET":
-			createType = "TIMESTAMP"
-		case "SMALLDATETIME":
-			createType = "TIMESTAMP"
-		case "TIME":
-			createType = "TIME"
-		case "TEXT":
-			createType = "TEXT"
-		case "NTEXT":
-			createType = "TEXT"
-		case "BINARY":
-			createType = "BINARY"
-		case "VARBINARY":
-			createType = "BINARY"
-		case "UNIQUEIDENTIFIER":
-			createType = "TEXT"
-		case "XML":
-			createType = "TEXT"
-		case "IMAGE":
-			createType = "BINARY"
-		case "DECIMAL":
-			createType = "FLOAT"
-		case "CHAR":
-			createType = "VARCHAR"
-		case "VARCHAR":
-			createType = "VARCHAR"
-		case "NCHAR":
-			createType = "VARCHAR"
-		case "NVARCHAR":
-			createType = "VARCHAR"
-		case "SQL_VARIANT":
-			createType = "TEXT"
-		case "GEOMETRY":
-			createType = "BINARY"
-		default:
-			return columnInfo, fmt.Errorf("unknown type while getting create table types: %v", dbType)
+		createType, err := driver.SnowflakeType(dbType, columnInfo.ColumnPrecisions[colNum], columnInfo.ColumnScales[colNum])
+		if err != nil {
+			return columnInfo, err
 		}
 
-		colName = strings.ToUpper(colName)
+		colName = SnowflakeColumnName(colName)
+		columnInfo.TargetColumnNames = append(columnInfo.TargetColumnNames, colName)
 
-		// colHasNonAlnum := hasNonAlnum(colName)
-
-		// colName = quoteIfTrue(colName, colHasNonAlnum)
-
-		// check for snowflake reserved keywords or numbers being the first character or non alphanumeric chars
-		if snowflakeReservedKeywords[colName] || !unicode.IsLetter(rune(colName[0])) || HasNonAlnumOrSpace(colName) {
-			colName = fmt.Sprintf(`"%v"`, colName)
-		}
+		columnInfo.ColumnTargetTypes = append(columnInfo.ColumnTargetTypes, strings.ToUpper(createType))
 
 		colNameAndType := fmt.Sprintf(`%v %v`, colName, strings.ToUpper(createType))
 		columnInfo.ColumnNamesAndTypes = append(columnInfo.ColumnNamesAndTypes, colNameAndType)
@@ -187,13 +203,30 @@ func GetGzipReader(contents string) (zr io.Reader, err error) {
 }
 
 func UploadAndTransfer(
+	ctx context.Context,
 	body string,
 	uploader *manager.Uploader,
 	tableName string,
 	transferId string,
 	s3Dir string,
 	s3Bucket string,
-) error {
+) (err error) {
+	ctx, span := tracer.Start(
+		ctx,
+		"UploadAndTransfer",
+		trace.WithAttributes(
+			attribute.String("sqlpipe.transfer_id", transferId),
+			attribute.String("sqlpipe.s3_bucket", s3Bucket),
+			attribute.Int("sqlpipe.bytes", len(body)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
 	randomChars, err := pkg.RandomCharacters(32)
 	if err != nil {
@@ -201,10 +234,11 @@ func UploadAndTransfer(
 	}
 
 	s3Path := fmt.Sprintf("%v/%v/%v/%v", s3Dir, transferId, tableName, randomChars)
+	span.SetAttributes(attribute.String("sqlpipe.s3_key", s3Path))
 
 	reader := strings.NewReader(body)
 
-	_, err = uploader.Upload(context.TODO(), &s3.PutObjectInput{
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket: &s3Bucket,
 		Key:    aws.String(s3Path),
 		Body:   reader,
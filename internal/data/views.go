@@ -0,0 +1,587 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	ViewsMaterialize = "materialize"
+	ViewsTranslate   = "translate"
+)
+
+const (
+	ViewCreated        = "created"
+	ViewUntranslatable = "untranslatable"
+	ViewFailed         = "failed"
+)
+
+// ViewReport records what happened to one source view in translate mode.
+type ViewReport struct {
+	Schema      string `json:"schema"`
+	View        string `json:"view"`
+	TargetView  string `json:"target_view,omitempty"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	TargetQuery string `json:"target_query,omitempty"`
+}
+
+const (
+	viewWord = iota
+	viewQuoted
+	viewString
+	viewNumber
+	viewSpace
+	viewPunct
+	viewVariable
+	viewTemp
+)
+
+type viewToken struct {
+	kind int
+	text string
+}
+
+func isViewWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@' || r == '#' || r == '$'
+}
+
+// tokenizeView splits a T-SQL module definition into tokens. Comments become
+// whitespace, quoted identifiers and strings are unescaped.
+func tokenizeView(definition string) ([]viewToken, error) {
+	src := []rune(definition)
+	tokens := []viewToken{}
+
+	space := func(text string) {
+		if strings.Contains(text, "\n") {
+			text = "\n"
+		} else {
+			text = " "
+		}
+		if len(tokens) > 0 && tokens[len(tokens)-1].kind == viewSpace {
+			if text == "\n" {
+				tokens[len(tokens)-1].text = text
+			}
+			return
+		}
+		tokens = append(tokens, viewToken{viewSpace, text})
+	}
+
+	for i := 0; i < len(src); {
+		r := src[i]
+		switch {
+		case unicode.IsSpace(r):
+			j := i
+			for j < len(src) && unicode.IsSpace(src[j]) {
+				j++
+			}
+			space(string(src[i:j]))
+			i = j
+
+		case r == '-' && i+1 < len(src) && src[i+1] == '-':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			space("\n")
+
+		case r == '/' && i+1 < len(src) && src[i+1] == '*':
+			depth := 0
+			for i < len(src) {
+				if src[i] == '/' && i+1 < len(src) && src[i+1] == '*' {
+					depth++
+					i += 2
+				} else if src[i] == '*' && i+1 < len(src) && src[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			space(" ")
+
+		case r == '[' || r == '"':
+			closing := ']'
+			if r == '"' {
+				closing = '"'
+			}
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(src) {
+					return nil, fmt.Errorf("unterminated identifier")
+				}
+				if src[j] == closing {
+					if j+1 < len(src) && src[j+1] == closing {
+						sb.WriteRune(closing)
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteRune(src[j])
+				j++
+			}
+			tokens = append(tokens, viewToken{viewQuoted, sb.String()})
+			i = j + 1
+
+		case r == '\'' || ((r == 'N' || r == 'n') && i+1 < len(src) && src[i+1] == '\''):
+			if r != '\'' {
+				i++
+			}
+			j := i + 1
+			for {
+				if j >= len(src) {
+					return nil, fmt.Errorf("unterminated string literal")
+				}
+				if src[j] == '\'' {
+					if j+1 < len(src) && src[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, viewToken{viewString, string(src[i+1 : j])})
+			i = j + 1
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(src) && unicode.IsDigit(src[i+1])):
+			j := i
+			for j < len(src) && (unicode.IsLetter(src[j]) || unicode.IsDigit(src[j]) || src[j] == '.' ||
+				((src[j] == '+' || src[j] == '-') && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, viewToken{viewNumber, string(src[i:j])})
+			i = j
+
+		case isViewWordRune(r):
+			j := i
+			for j < len(src) && isViewWordRune(src[j]) {
+				j++
+			}
+			kind := viewWord
+			if r == '@' {
+				kind = viewVariable
+			} else if r == '#' {
+				kind = viewTemp
+			}
+			tokens = append(tokens, viewToken{kind, string(src[i:j])})
+			i = j
+
+		default:
+			text := string(r)
+			if i+1 < len(src) {
+				switch string(src[i : i+2]) {
+				case "<>", "<=", ">=", "!=", "!<", "!>":
+					text = string(src[i : i+2])
+				}
+			}
+			tokens = append(tokens, viewToken{viewPunct, text})
+			i += len([]rune(text))
+		}
+	}
+
+	return tokens, nil
+}
+
+// viewFunctions renames T-SQL functions Snowflake knows under another name.
+var viewFunctions = map[string]string{
+	"ISNULL":         "IFNULL",
+	"IIF":            "IFF",
+	"LEN":            "LENGTH",
+	"DATALENGTH":     "OCTET_LENGTH",
+	"GETDATE":        "CURRENT_TIMESTAMP",
+	"SYSDATETIME":    "CURRENT_TIMESTAMP",
+	"GETUTCDATE":     "SYSDATE",
+	"SYSUTCDATETIME": "SYSDATE",
+	"NEWID":          "UUID_STRING",
+	"DATEPART":       "DATE_PART",
+}
+
+// viewTypes renames T-SQL types used in CAST.
+var viewTypes = map[string]string{
+	"BIT":              "BOOLEAN",
+	"DATETIME":         "TIMESTAMP_NTZ",
+	"DATETIME2":        "TIMESTAMP_NTZ",
+	"SMALLDATETIME":    "TIMESTAMP_NTZ",
+	"DATETIMEOFFSET":   "TIMESTAMP_TZ",
+	"UNIQUEIDENTIFIER": "VARCHAR",
+	"MONEY":            "NUMBER(19, 4)",
+	"SMALLMONEY":       "NUMBER(10, 4)",
+	"NTEXT":            "TEXT",
+	"IMAGE":            "BINARY",
+}
+
+// viewUnsupported lists constructs that have no direct Snowflake equivalent.
+var viewUnsupported = map[string]string{
+	"TOP":            "TOP",
+	"APPLY":          "CROSS or OUTER APPLY",
+	"PIVOT":          "PIVOT",
+	"UNPIVOT":        "UNPIVOT",
+	"XML":            "FOR XML",
+	"OPENQUERY":      "OPENQUERY",
+	"OPENROWSET":     "OPENROWSET",
+	"OPENDATASOURCE": "OPENDATASOURCE",
+	"OPENJSON":       "OPENJSON",
+	"CONVERT":        "CONVERT",
+	"TRY_CONVERT":    "TRY_CONVERT",
+	"FORMAT":         "FORMAT",
+	"STUFF":          "STUFF",
+	"PATINDEX":       "PATINDEX",
+	"STRING_AGG":     "STRING_AGG",
+	"CONTAINSTABLE":  "full-text search",
+	"FREETEXTTABLE":  "full-text search",
+	"CONTAINS":       "full-text search",
+	"FREETEXT":       "full-text search",
+}
+
+var viewTableHints = map[string]bool{
+	"NOLOCK": true, "READUNCOMMITTED": true, "READCOMMITTED": true, "READCOMMITTEDLOCK": true,
+	"REPEATABLEREAD": true, "SERIALIZABLE": true, "HOLDLOCK": true, "UPDLOCK": true, "XLOCK": true,
+	"ROWLOCK": true, "PAGLOCK": true, "TABLOCK": true, "TABLOCKX": true, "NOWAIT": true,
+	"READPAST": true, "INDEX": true, "FORCESEEK": true, "FORCESCAN": true, "NOEXPAND": true,
+}
+
+// viewOperatorWords are keywords after which + is a unary plus.
+var viewOperatorWords = map[string]bool{
+	"SELECT": true, "WHERE": true, "HAVING": true, "ON": true, "AND": true, "OR": true,
+	"NOT": true, "WHEN": true, "THEN": true, "ELSE": true, "BY": true, "IN": true, "BETWEEN": true,
+}
+
+// viewClauseEnds are keywords after which identifiers no longer name tables.
+var viewClauseEnds = map[string]bool{
+	"SELECT": true, "WHERE": true, "GROUP": true, "ORDER": true, "HAVING": true,
+	"UNION": true, "EXCEPT": true, "INTERSECT": true, "ON": true,
+}
+
+// TranslateView rewrites a CREATE VIEW definition read from sys.sql_modules
+// into the column list and SELECT of an equivalent Snowflake view. Tables
+// and views are looked up with resolve, which returns the fully qualified
+// Snowflake name of a replicated object. The translation is conservative:
+// anything it cannot map with confidence is reported as an error rather
+// than guessed at.
+func TranslateView(definition, sourceDb, viewSchema string, resolve func(schema, name string) (string, bool)) ([]string, string, error) {
+	tokens, err := tokenizeView(definition)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Significant tokens only; whitespace is re-added as single spaces or
+	// newlines between them.
+	type sig struct {
+		viewToken
+		spaceBefore string
+	}
+	toks := []sig{}
+	pending := ""
+	for _, token := range tokens {
+		if token.kind == viewSpace {
+			pending = token.text
+			continue
+		}
+		toks = append(toks, sig{token, pending})
+		pending = ""
+	}
+
+	isWord := func(i int, words ...string) bool {
+		if i < 0 || i >= len(toks) || toks[i].kind != viewWord {
+			return false
+		}
+		for _, word := range words {
+			if strings.EqualFold(toks[i].text, word) {
+				return true
+			}
+		}
+		return false
+	}
+	isPunct := func(i int, text string) bool {
+		return i >= 0 && i < len(toks) && toks[i].kind == viewPunct && toks[i].text == text
+	}
+	isIdent := func(i int) bool {
+		return i >= 0 && i < len(toks) && (toks[i].kind == viewWord || toks[i].kind == viewQuoted)
+	}
+
+	// CREATE [OR ALTER] VIEW name [(columns)] [WITH options] AS
+	i := 0
+	for i < len(toks) && !isWord(i, "VIEW") {
+		i++
+	}
+	if i == len(toks) {
+		return nil, "", fmt.Errorf("definition is not a CREATE VIEW statement")
+	}
+	i++
+	for isIdent(i) && isPunct(i+1, ".") {
+		i += 2
+	}
+	i++
+
+	columns := []string{}
+	if isPunct(i, "(") {
+		i++
+		for !isPunct(i, ")") {
+			if i >= len(toks) {
+				return nil, "", fmt.Errorf("unterminated column list")
+			}
+			if isIdent(i) {
+				columns = append(columns, SnowflakeColumnName(toks[i].text))
+			}
+			i++
+		}
+		i++
+	}
+	if isWord(i, "WITH") {
+		for i < len(toks) && !isWord(i, "AS") {
+			i++
+		}
+	}
+	if !isWord(i, "AS") {
+		return nil, "", fmt.Errorf("could not find the AS of the view definition")
+	}
+	toks = toks[i+1:]
+
+	for len(toks) > 0 && isPunct(len(toks)-1, ";") {
+		toks = toks[:len(toks)-1]
+	}
+	if n := len(toks); n >= 3 && isWord(n-3, "WITH") && isWord(n-2, "CHECK") && isWord(n-1, "OPTION") {
+		toks = toks[:n-3]
+	}
+
+	// Names defined by common table expressions are not source tables.
+	ctes := map[string]bool{}
+	for j := range toks {
+		if isIdent(j) && isWord(j+1, "AS") && isPunct(j+2, "(") {
+			ctes[strings.ToUpper(toks[j].text)] = true
+		}
+	}
+
+	resolveTable := func(parts []viewToken) (string, bool) {
+		switch len(parts) {
+		case 1:
+			if name, ok := resolve(viewSchema, parts[0].text); ok {
+				return name, true
+			}
+			return resolve("dbo", parts[0].text)
+		case 2:
+			return resolve(parts[0].text, parts[1].text)
+		case 3:
+			if strings.EqualFold(parts[0].text, sourceDb) {
+				return resolve(parts[1].text, parts[2].text)
+			}
+		}
+		return "", false
+	}
+
+	identifier := func(token viewToken) string {
+		if token.kind == viewQuoted {
+			return SnowflakeColumnName(token.text)
+		}
+		return token.text
+	}
+
+	partsName := func(parts []viewToken) string {
+		names := make([]string, len(parts))
+		for j, part := range parts {
+			names[j] = part.text
+		}
+		return strings.Join(names, ".")
+	}
+
+	var sb strings.Builder
+	emit := func(space, text string) {
+		if sb.Len() > 0 {
+			sb.WriteString(space)
+		}
+		sb.WriteString(text)
+	}
+
+	// closing returns the index of the parenthesis closing the one at open.
+	closing := func(open int) int {
+		depth := 0
+		for j := open; j < len(toks); j++ {
+			if isPunct(j, "(") {
+				depth++
+			} else if isPunct(j, ")") {
+				depth--
+				if depth == 0 {
+					return j
+				}
+			}
+		}
+		return len(toks) - 1
+	}
+
+	isHint := func(open int) bool {
+		return isPunct(open, "(") && open+1 < len(toks) && toks[open+1].kind == viewWord && viewTableHints[strings.ToUpper(toks[open+1].text)]
+	}
+
+	inFrom := false
+	prev := -1
+	lastTable := -2
+
+	for i := 0; i < len(toks); i++ {
+		token := toks[i]
+		tableContext := isWord(prev, "FROM", "JOIN") || (inFrom && isPunct(prev, ","))
+
+		switch token.kind {
+		case viewVariable:
+			return nil, "", fmt.Errorf("uses variable %v", token.text)
+		case viewTemp:
+			return nil, "", fmt.Errorf("uses temporary object %v", token.text)
+		case viewNumber:
+			if strings.HasPrefix(strings.ToLower(token.text), "0x") {
+				return nil, "", fmt.Errorf("uses binary literal %v", token.text)
+			}
+			emit(token.spaceBefore, token.text)
+		case viewString:
+			emit(token.spaceBefore, "'"+strings.ReplaceAll(token.text, `\`, `\\`)+"'")
+		case viewPunct:
+			switch {
+			case token.text == "!<" || token.text == "!>":
+				return nil, "", fmt.Errorf("uses operator %v", token.text)
+			case token.text == "+":
+				// T-SQL overloads + for concatenation. Only a literal operand
+				// tells which one is meant.
+				left, right := -1, -1
+				if i > 0 {
+					left = toks[i-1].kind
+				}
+				if i+1 < len(toks) {
+					right = toks[i+1].kind
+				}
+				unary := i == 0 || (left == viewPunct && toks[i-1].text != ")") || (left == viewWord && viewOperatorWords[strings.ToUpper(toks[i-1].text)])
+				switch {
+				case left == viewString || right == viewString:
+					emit(token.spaceBefore, "||")
+				case unary || left == viewNumber || right == viewNumber:
+					emit(token.spaceBefore, token.text)
+				default:
+					return nil, "", fmt.Errorf("uses + between non-literal operands, which may be addition or concatenation")
+				}
+			case isHint(i) && (prev == lastTable || prev == lastTable+1 || prev == lastTable+2 && isWord(lastTable+1, "AS")):
+				// A bare table hint after a table or its alias: drop it.
+				i = closing(i)
+				continue
+			default:
+				emit(token.spaceBefore, token.text)
+			}
+		case viewWord, viewQuoted:
+			upper := strings.ToUpper(token.text)
+
+			if token.kind == viewWord {
+				if reason, ok := viewUnsupported[upper]; ok {
+					return nil, "", fmt.Errorf("uses %v, which has no Snowflake equivalent", reason)
+				}
+				if upper == "WITH" && isHint(i+1) {
+					i = closing(i + 1)
+					continue
+				}
+				if viewClauseEnds[upper] {
+					inFrom = false
+				}
+				if upper == "FROM" {
+					inFrom = true
+				}
+			}
+
+			// Collect a multi-part name.
+			parts := []viewToken{token.viewToken}
+			star := false
+			j := i
+			for isPunct(j+1, ".") && (isIdent(j+2) || isPunct(j+2, "*")) {
+				if isPunct(j+2, "*") {
+					star = true
+					j += 2
+					break
+				}
+				parts = append(parts, toks[j+2].viewToken)
+				j += 2
+			}
+
+			if isPunct(j+1, "(") {
+				if len(parts) > 1 || tableContext {
+					return nil, "", fmt.Errorf("calls function %v", partsName(parts))
+				}
+				name := token.text
+				if renamed, ok := viewFunctions[upper]; ok && token.kind == viewWord {
+					name = renamed
+				}
+				if renamed, ok := viewTypes[upper]; ok && token.kind == viewWord && isWord(prev, "AS") {
+					name = renamed
+				}
+				// VARCHAR(MAX) and friends: Snowflake's types default to their maximum.
+				if isWord(j+2, "MAX") && isPunct(j+3, ")") {
+					emit(token.spaceBefore, name)
+					i = j + 3
+					prev = i
+					continue
+				}
+				emit(token.spaceBefore, name)
+				i = j
+				prev = i
+				continue
+			}
+
+			if len(parts) > 3 {
+				return nil, "", fmt.Errorf("references %v on another server", partsName(parts))
+			}
+
+			if tableContext && !star && !(len(parts) == 1 && ctes[upper]) {
+				name, ok := resolveTable(parts)
+				if !ok {
+					return nil, "", fmt.Errorf("references %v, which is not replicated", partsName(parts))
+				}
+				emit(token.spaceBefore, name)
+				i = j
+				prev = i
+				lastTable = i
+				continue
+			}
+
+			var text string
+			switch {
+			case len(parts) == 1 && token.kind == viewWord && isWord(prev, "AS") && isPunct(i+1, ")") && viewTypes[upper] != "":
+				text = viewTypes[upper]
+			case len(parts) == 1:
+				text = identifier(token.viewToken)
+			case len(parts) == 3:
+				name, ok := resolveTable(parts[:2])
+				if !ok {
+					return nil, "", fmt.Errorf("references %v, which is not replicated", partsName(parts[:2]))
+				}
+				text = name + "." + SnowflakeColumnName(parts[2].text)
+			default:
+				if name, ok := resolveTable(parts); ok && !star {
+					text = name
+				} else if len(parts) == 2 && !star {
+					text = identifier(parts[0]) + "." + SnowflakeColumnName(parts[1].text)
+				} else {
+					names := make([]string, len(parts))
+					for k, part := range parts {
+						names[k] = identifier(part)
+					}
+					text = strings.Join(names, ".")
+				}
+			}
+			if star {
+				text += ".*"
+			}
+			emit(token.spaceBefore, text)
+			i = j
+		}
+		prev = i
+	}
+
+	query := strings.TrimSpace(sb.String())
+	if query == "" {
+		return nil, "", fmt.Errorf("view has no query")
+	}
+
+	return columns, query, nil
+}
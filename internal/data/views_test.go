@@ -0,0 +1,127 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTranslateView(t *testing.T) {
+	resolve := func(schema, name string) (string, bool) {
+		switch strings.ToLower(schema + "." + name) {
+		case "dbo.orders", "dbo.customers", "sales.regions":
+			return "DB.PROD." + strings.ToUpper(schema+"_"+name), true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name       string
+		definition string
+		columns    []string
+		query      string
+		err        string
+	}{
+		{
+			name:       "table hints",
+			definition: "CREATE VIEW dbo.v AS SELECT o.id FROM Orders o (nolock) JOIN dbo.Customers AS c WITH (NOLOCK, INDEX(ix)) ON c.id = o.customer_id",
+			columns:    []string{},
+			query:      `SELECT o.ID FROM DB.PROD.DBO_ORDERS o JOIN DB.PROD.DBO_CUSTOMERS AS c ON c.ID = o."CUSTOMER_ID"`,
+		},
+		{
+			name:       "cte and column list",
+			definition: "CREATE VIEW [dbo].[v] ([Id], [Name]) AS WITH recent AS (SELECT id, name FROM dbo.Orders) SELECT id, name FROM recent;",
+			columns:    []string{"ID", "NAME"},
+			query:      "WITH recent AS (SELECT id, name FROM DB.PROD.DBO_ORDERS) SELECT id, name FROM recent",
+		},
+		{
+			name:       "multi-part names",
+			definition: "CREATE VIEW dbo.v AS SELECT dbo.Orders.id, Sales.Regions.[Region Name] FROM src.dbo.Orders, Sales.Regions",
+			columns:    []string{},
+			query:      `SELECT DB.PROD.DBO_ORDERS.ID, DB.PROD.SALES_REGIONS."REGION NAME" FROM DB.PROD.DBO_ORDERS, DB.PROD.SALES_REGIONS`,
+		},
+		{
+			name:       "functions, types and check option",
+			definition: "CREATE VIEW dbo.v AS SELECT ISNULL(name, 'n/a'), LEN(name), CAST(id AS bit), CAST(note AS nvarchar(max)) FROM dbo.Customers WITH CHECK OPTION",
+			columns:    []string{},
+			query:      "SELECT IFNULL(name, 'n/a'), LENGTH(name), CAST(id AS BOOLEAN), CAST(note AS nvarchar) FROM DB.PROD.DBO_CUSTOMERS",
+		},
+		{
+			name:       "plus with a literal operand",
+			definition: "CREATE VIEW dbo.v AS SELECT first + ' ' + last AS name, total + 1, -total, +total FROM dbo.Customers",
+			columns:    []string{},
+			query:      "SELECT first || ' ' || last AS name, total + 1, -total, +total FROM DB.PROD.DBO_CUSTOMERS",
+		},
+		{
+			name:       "plus between columns",
+			definition: "CREATE VIEW dbo.v AS SELECT a.name + b.name FROM dbo.Orders a, dbo.Customers b",
+			err:        "uses + between non-literal operands",
+		},
+		{
+			name:       "plus between expressions",
+			definition: "CREATE VIEW dbo.v AS SELECT (a.x) + (b.y) FROM dbo.Orders a, dbo.Customers b",
+			err:        "uses + between non-literal operands",
+		},
+		{
+			name:       "top",
+			definition: "CREATE VIEW dbo.v AS SELECT TOP 10 id FROM dbo.Orders",
+			err:        "uses TOP",
+		},
+		{
+			name:       "apply",
+			definition: "CREATE VIEW dbo.v AS SELECT id FROM dbo.Orders CROSS APPLY dbo.f(id)",
+			err:        "uses CROSS or OUTER APPLY",
+		},
+		{
+			name:       "convert",
+			definition: "CREATE VIEW dbo.v AS SELECT CONVERT(int, id) FROM dbo.Orders",
+			err:        "uses CONVERT",
+		},
+		{
+			name:       "variable",
+			definition: "CREATE VIEW dbo.v AS SELECT id FROM dbo.Orders WHERE id > @x",
+			err:        "uses variable @x",
+		},
+		{
+			name:       "table not replicated",
+			definition: "CREATE VIEW dbo.v AS SELECT id FROM dbo.Missing",
+			err:        "references dbo.Missing, which is not replicated",
+		},
+		{
+			name:       "other database",
+			definition: "CREATE VIEW dbo.v AS SELECT o.* FROM other.dbo.Orders o",
+			err:        "references other.dbo.Orders, which is not replicated",
+		},
+		{
+			name:       "linked server",
+			definition: "CREATE VIEW dbo.v AS SELECT id FROM srv.src.dbo.Orders",
+			err:        "on another server",
+		},
+		{
+			name:       "not a view",
+			definition: "CREATE PROCEDURE dbo.p AS SELECT 1",
+			err:        "not a CREATE VIEW statement",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, query, err := TranslateView(tt.definition, "src", "dbo", resolve)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("got columns %q, want %q", columns, tt.columns)
+			}
+			if query != tt.query {
+				t.Errorf("got query\n%v\nwant\n%v", query, tt.query)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	binaryWatermarkRX   = regexp.MustCompile(`^0x[0-9A-Fa-f]+$`)
+	integerWatermarkRX  = regexp.MustCompile(`^-?[0-9]+$`)
+	datetimeWatermarkRX = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}(T[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?)?$`)
+)
+
+// Watermark is a column whose value only grows as rows are inserted or
+// updated: a rowversion, a datetime or an identity. Values are carried
+// between runs as strings in SQL Server's own text form.
+//
+// A rowversion run stops below MIN_ACTIVE_ROWVERSION(), so rows of
+// transactions still open when it starts are read by the next run. Datetime
+// and identity values have no such bound: they are assigned when a row is
+// written, not when its transaction commits, so a row committed after a run
+// read past its value is never extracted. Use those only for tables written
+// in short transactions, or where such rows are loaded some other way.
+type Watermark struct {
+	Column string
+	kind   string
+	// literalType is the type datetime literals are converted to. Comparing
+	// a datetime with a datetime2 widens its .003 and .007 milliseconds, so
+	// literals keep the column's own type.
+	literalType string
+}
+
+// NewWatermark checks that a column of the given SQL Server type (as named by
+// type_name()) can be used as a watermark.
+func NewWatermark(column, sqlType string, scale int) (Watermark, error) {
+	w := Watermark{Column: column}
+
+	switch strings.ToLower(sqlType) {
+	case "timestamp", "rowversion":
+		w.kind = "rowversion"
+	case "binary":
+		w.kind = "binary"
+	case "bigint", "int", "smallint", "tinyint":
+		w.kind = "integer"
+	case "decimal", "numeric":
+		if scale != 0 {
+			return w, fmt.Errorf("watermark column %v must have a scale of 0", column)
+		}
+		w.kind = "integer"
+	case "date", "datetime", "smalldatetime":
+		w.kind = "datetime"
+		w.literalType = strings.ToLower(sqlType)
+	case "datetime2":
+		w.kind = "datetime"
+		w.literalType = "datetime2(7)"
+	default:
+		return w, fmt.Errorf("watermark column %v has unsupported type %v", column, sqlType)
+	}
+
+	return w, nil
+}
+
+// UpperBoundQuery selects, as text, the bound a run reads up to: the lowest
+// rowversion of any open transaction, which no committed row has yet reached,
+// or else the column's current maximum in from.
+func (w Watermark) UpperBoundQuery(from string) string {
+	column := QuoteMssqlIdentifier(w.Column)
+
+	switch w.kind {
+	case "rowversion":
+		return "select convert(varchar(34), min_active_rowversion(), 1)"
+	case "binary":
+		return fmt.Sprintf("select convert(varchar(34), max(%v), 1) from %v", column, from)
+	case "datetime":
+		return fmt.Sprintf("select convert(varchar(33), max(%v), 126) from %v", column, from)
+	default:
+		return fmt.Sprintf("select convert(varchar(40), max(%v)) from %v", column, from)
+	}
+}
+
+// Literal renders a stored value as a T-SQL literal. Values are inlined into
+// queries, so anything that does not look like the column's type is rejected.
+func (w Watermark) Literal(value string) (string, error) {
+	switch w.kind {
+	case "rowversion", "binary":
+		if binaryWatermarkRX.MatchString(value) {
+			return value, nil
+		}
+	case "integer":
+		if integerWatermarkRX.MatchString(value) {
+			return value, nil
+		}
+	case "datetime":
+		if datetimeWatermarkRX.MatchString(value) {
+			return fmt.Sprintf("convert(%v, '%v', 126)", w.literalType, value), nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid watermark value %q for column %v", value, w.Column)
+}
+
+// Predicate limits a query to rows after low and up to high. Either bound
+// may be empty. A rowversion high is exclusive, as is the upper bound read
+// for it, so the next run starts at it instead of after it.
+func (w Watermark) Predicate(low, high string) (string, error) {
+	column := QuoteMssqlIdentifier(w.Column)
+	predicates := []string{}
+
+	lowOperator, highOperator := ">", "<="
+	if w.kind == "rowversion" {
+		lowOperator, highOperator = ">=", "<"
+	}
+
+	if low != "" {
+		literal, err := w.Literal(low)
+		if err != nil {
+			return "", err
+		}
+		predicates = append(predicates, fmt.Sprintf("%v %v %v", column, lowOperator, literal))
+	}
+
+	if high != "" {
+		literal, err := w.Literal(high)
+		if err != nil {
+			return "", err
+		}
+		predicates = append(predicates, fmt.Sprintf("%v %v %v", column, highOperator, literal))
+	}
+
+	return strings.Join(predicates, " and "), nil
+}
@@ -0,0 +1,71 @@
+package data
+
+import "testing"
+
+func TestWatermarkPredicate(t *testing.T) {
+	tests := []struct {
+		sqlType   string
+		scale     int
+		low, high string
+		want      string
+	}{
+		{"timestamp", 0, "0x00000000000007D1", "0x00000000000007E5", "[w] >= 0x00000000000007D1 and [w] < 0x00000000000007E5"},
+		{"rowversion", 0, "", "0x00000000000007E5", "[w] < 0x00000000000007E5"},
+		{"binary", 0, "0x01", "0x02", "[w] > 0x01 and [w] <= 0x02"},
+		{"bigint", 0, "-5", "42", "[w] > -5 and [w] <= 42"},
+		{"decimal", 0, "", "12345678901234567890", "[w] <= 12345678901234567890"},
+		{"datetime", 0, "2023-01-01T00:00:00.003", "2023-01-02T10:20:30.007", "[w] > convert(datetime, '2023-01-01T00:00:00.003', 126) and [w] <= convert(datetime, '2023-01-02T10:20:30.007', 126)"},
+		{"smalldatetime", 0, "", "2023-01-02T10:20:00", "[w] <= convert(smalldatetime, '2023-01-02T10:20:00', 126)"},
+		{"date", 0, "2023-01-01", "", "[w] > convert(date, '2023-01-01', 126)"},
+		{"datetime2", 7, "", "2023-01-02T10:20:30.1234567", "[w] <= convert(datetime2(7), '2023-01-02T10:20:30.1234567', 126)"},
+		{"int", 0, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		w, err := NewWatermark("w", tt.sqlType, tt.scale)
+		if err != nil {
+			t.Fatalf("NewWatermark(%q) returned %v", tt.sqlType, err)
+		}
+		got, err := w.Predicate(tt.low, tt.high)
+		if err != nil {
+			t.Errorf("%v: Predicate(%q, %q) returned %v", tt.sqlType, tt.low, tt.high, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%v: Predicate(%q, %q) = %q, want %q", tt.sqlType, tt.low, tt.high, got, tt.want)
+		}
+	}
+}
+
+func TestWatermarkLiteralRejectsForeignValues(t *testing.T) {
+	tests := []struct {
+		sqlType string
+		value   string
+	}{
+		{"rowversion", "1; drop table t"},
+		{"binary", "0xZZ"},
+		{"int", "1.5"},
+		{"datetime", "2023-01-01' or 1=1 --"},
+		{"date", "yesterday"},
+	}
+
+	for _, tt := range tests {
+		w, err := NewWatermark("w", tt.sqlType, 0)
+		if err != nil {
+			t.Fatalf("NewWatermark(%q) returned %v", tt.sqlType, err)
+		}
+		_, err = w.Literal(tt.value)
+		if err == nil {
+			t.Errorf("%v: Literal(%q) returned no error", tt.sqlType, tt.value)
+		}
+	}
+
+	_, err := NewWatermark("w", "decimal", 2)
+	if err == nil {
+		t.Error("NewWatermark accepted a decimal with a scale")
+	}
+	_, err = NewWatermark("w", "varchar", 0)
+	if err == nil {
+		t.Error("NewWatermark accepted a varchar")
+	}
+}
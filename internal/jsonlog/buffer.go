@@ -0,0 +1,135 @@
+package jsonlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type BufferedEntry struct {
+	Seq int64 `json:"seq"`
+	Entry
+	level Level
+}
+
+// Buffer keeps the most recent log entries in memory, discarding the oldest
+// once it holds capacity entries. Each entry gets an increasing sequence
+// number so readers can poll for entries they have not seen yet. Stack
+// traces are not kept, as buffers are served to API clients.
+type Buffer struct {
+	mu       sync.Mutex
+	minLevel Level
+	entries  []BufferedEntry
+	next     int
+	seq      int64
+	out      io.Writer
+}
+
+func NewBuffer(capacity int, minLevel Level) *Buffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &Buffer{
+		minLevel: minLevel,
+		entries:  make([]BufferedEntry, 0, capacity),
+	}
+}
+
+func (b *Buffer) add(level Level, entry Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	entry.Trace = ""
+	buffered := BufferedEntry{Seq: b.seq, Entry: entry, level: level}
+
+	if b.out != nil {
+		line, err := json.Marshal(buffered)
+		if err == nil {
+			b.out.Write(append(line, '\n'))
+		}
+	}
+
+	b.keep(buffered)
+}
+
+func (b *Buffer) keep(buffered BufferedEntry) {
+	if len(b.entries) < cap(b.entries) {
+		b.entries = append(b.entries, buffered)
+		return
+	}
+
+	b.entries[b.next] = buffered
+	b.next = (b.next + 1) % len(b.entries)
+}
+
+// Entries returns, oldest first, the buffered entries at or above minLevel
+// with a sequence number greater than after. A positive tail keeps only the
+// last tail of those.
+func (b *Buffer) Entries(minLevel Level, after int64, tail int) []BufferedEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := []BufferedEntry{}
+	for i := 0; i < len(b.entries); i++ {
+		entry := b.entries[(b.next+i)%len(b.entries)]
+		if entry.level >= minLevel && entry.Seq > after {
+			entries = append(entries, entry)
+		}
+	}
+
+	if tail > 0 && len(entries) > tail {
+		entries = entries[len(entries)-tail:]
+	}
+
+	return entries
+}
+
+// Dropped returns how many entries have been discarded to stay within the
+// buffer's capacity.
+func (b *Buffer) Dropped() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.seq - int64(len(b.entries))
+}
+
+// PersistTo makes the buffer also write every entry it keeps to w, one JSON
+// object per line, so Restore can read them back after a restart. Write
+// errors are left to w to report.
+func (b *Buffer) PersistTo(w io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.out = w
+}
+
+// Restore refills the buffer with entries written by PersistTo, keeping
+// their sequence numbers.
+func (b *Buffer) Restore(r io.Reader) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var buffered BufferedEntry
+		err := json.Unmarshal(scanner.Bytes(), &buffered)
+		if err != nil {
+			return fmt.Errorf("unable to parse log entry: %v", err)
+		}
+		buffered.level, err = ParseLevel(buffered.Level)
+		if err != nil {
+			return err
+		}
+		if buffered.Seq > b.seq {
+			b.seq = buffered.Seq
+		}
+		b.keep(buffered)
+	}
+
+	return scanner.Err()
+}
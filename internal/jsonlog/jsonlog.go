@@ -2,9 +2,11 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,7 +14,9 @@ import (
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,8 +24,12 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
@@ -31,23 +39,84 @@ func (l Level) String() string {
 	}
 }
 
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelFatal; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	if strings.EqualFold(s, "OFF") {
+		return LevelOff, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+type Entry struct {
+	Level      string            `json:"level"`
+	Time       string            `json:"time"`
+	Message    string            `json:"message"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Trace      string            `json:"trace,omitempty"`
+}
+
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	out        io.Writer
+	minLevel   Level
+	mu         *sync.Mutex
+	properties map[string]string
+	buffers    []*Buffer
 }
 
 func New(out io.Writer, minLevel Level) *Logger {
 	return &Logger{
 		out:      out,
 		minLevel: minLevel,
+		mu:       &sync.Mutex{},
 	}
 }
 
+// With returns a logger that writes to the same output as l and adds the
+// given properties to every line. Properties passed to an individual Print
+// call take precedence over these.
+func (l *Logger) With(properties map[string]string) *Logger {
+	merged := make(map[string]string, len(l.properties)+len(properties))
+	for k, v := range l.properties {
+		merged[k] = v
+	}
+	for k, v := range properties {
+		merged[k] = v
+	}
+
+	return &Logger{
+		out:        l.out,
+		minLevel:   l.minLevel,
+		mu:         l.mu,
+		properties: merged,
+		buffers:    l.buffers,
+	}
+}
+
+// WithBuffer returns a logger that also records its entries in buffer. The
+// buffer applies its own minimum level, so it can keep lines that l's output
+// filters out.
+func (l *Logger) WithBuffer(buffer *Buffer) *Logger {
+	child := l.With(nil)
+	child.buffers = append(append([]*Buffer(nil), l.buffers...), buffer)
+	return child
+}
+
+func (l *Logger) PrintDebug(message string, properties map[string]string) {
+	l.print(LevelDebug, message, properties)
+}
+
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
 	l.print(LevelInfo, message, properties)
 }
 
+func (l *Logger) PrintWarn(message string, properties map[string]string) {
+	l.print(LevelWarn, message, properties)
+}
+
 func (l *Logger) PrintError(err error, properties map[string]string) {
 	l.print(LevelError, err.Error(), properties)
 }
@@ -58,17 +127,29 @@ func (l *Logger) PrintFatal(err error, properties map[string]string) {
 }
 
 func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+	buffered := false
+	for _, buffer := range l.buffers {
+		if level >= buffer.minLevel {
+			buffered = true
+		}
+	}
+
+	if level < l.minLevel && !buffered {
 		return 0, nil
 	}
 
-	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
-	}{
+	if len(l.properties) > 0 {
+		merged := make(map[string]string, len(l.properties)+len(properties))
+		for k, v := range l.properties {
+			merged[k] = v
+		}
+		for k, v := range properties {
+			merged[k] = v
+		}
+		properties = merged
+	}
+
+	aux := Entry{
 		Level:      level.String(),
 		Time:       time.Now().UTC().Format(time.RFC3339),
 		Message:    message,
@@ -79,6 +160,16 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 		aux.Trace = string(debug.Stack())
 	}
 
+	for _, buffer := range l.buffers {
+		if level >= buffer.minLevel {
+			buffer.add(level, aux)
+		}
+	}
+
+	if level < l.minLevel {
+		return 0, nil
+	}
+
 	var line []byte
 
 	line, err := json.Marshal(aux)
@@ -0,0 +1,221 @@
+package logsink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Limits imposed by the PutLogEvents API.
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	maxEventBytes  = 262144
+	eventOverhead  = 26
+)
+
+type CloudWatchOptions struct {
+	// BufferSize is the number of events that can be queued before new
+	// events are dropped.
+	BufferSize int
+	// FlushInterval is the longest an event waits in a partial batch.
+	FlushInterval time.Duration
+	// Fallback receives the messages of any batch that could not be
+	// delivered. It may be nil, in which case those messages are lost.
+	Fallback io.Writer
+}
+
+// CloudWatch is an io.Writer that ships each write as a CloudWatch log event.
+// Writes never block on the network: events are queued and sent in batches
+// by a background goroutine, and dropped (and counted) when the queue is full.
+type CloudWatch struct {
+	client   *cloudwatchlogs.Client
+	group    string
+	stream   string
+	opts     CloudWatchOptions
+	events   chan types.InputLogEvent
+	quit     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	fallback sync.Mutex
+	lastErr  atomic.Value
+}
+
+func NewCloudWatch(client *cloudwatchlogs.Client, group, stream string, opts CloudWatchOptions) *CloudWatch {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+
+	cw := &CloudWatch{
+		client: client,
+		group:  group,
+		stream: stream,
+		opts:   opts,
+		events: make(chan types.InputLogEvent, opts.BufferSize),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go cw.run()
+
+	return cw
+}
+
+func (cw *CloudWatch) Write(p []byte) (int, error) {
+	message := string(p)
+	if len(message) > 0 && message[len(message)-1] == '\n' {
+		message = message[:len(message)-1]
+	}
+	if len(message) > maxEventBytes-eventOverhead {
+		// Cut at the start of a rune so the message stays valid UTF-8.
+		end := maxEventBytes - eventOverhead
+		for end > 0 && !utf8.RuneStart(message[end]) {
+			end--
+		}
+		message = message[:end]
+	}
+
+	event := types.InputLogEvent{
+		Message:   aws.String(message),
+		Timestamp: aws.Int64(time.Now().UnixMilli()),
+	}
+
+	select {
+	case <-cw.quit:
+		cw.dropped.Add(1)
+	case cw.events <- event:
+	default:
+		cw.dropped.Add(1)
+	}
+
+	return len(p), nil
+}
+
+// Dropped returns the number of events discarded because the queue was full
+// or the shipper was already closed.
+func (cw *CloudWatch) Dropped() int64 {
+	return cw.dropped.Load()
+}
+
+// Failed returns the number of events that CloudWatch did not accept and
+// that were handed to the fallback writer instead.
+func (cw *CloudWatch) Failed() int64 {
+	return cw.failed.Load()
+}
+
+// LastError returns the error from the most recent PutLogEvents call, or nil
+// if it succeeded or nothing has been sent yet.
+func (cw *CloudWatch) LastError() error {
+	err, _ := cw.lastErr.Load().(sendError)
+	return err.err
+}
+
+// sendError wraps errors stored in lastErr, since atomic.Value requires every
+// stored value to have the same concrete type.
+type sendError struct {
+	err error
+}
+
+// Close flushes every queued event and stops the background goroutine.
+func (cw *CloudWatch) Close() error {
+	cw.once.Do(func() {
+		close(cw.quit)
+	})
+	<-cw.done
+	return nil
+}
+
+func (cw *CloudWatch) run() {
+	defer close(cw.done)
+
+	ticker := time.NewTicker(cw.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []types.InputLogEvent
+	batchBytes := 0
+
+	add := func(event types.InputLogEvent) {
+		size := len(*event.Message) + eventOverhead
+		if len(batch) == maxBatchEvents || batchBytes+size > maxBatchBytes {
+			cw.send(batch)
+			batch = nil
+			batchBytes = 0
+		}
+		batch = append(batch, event)
+		batchBytes += size
+	}
+
+	for {
+		select {
+		case event := <-cw.events:
+			add(event)
+		case <-ticker.C:
+			cw.send(batch)
+			batch = nil
+			batchBytes = 0
+		case <-cw.quit:
+			for {
+				select {
+				case event := <-cw.events:
+					add(event)
+				default:
+					cw.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (cw *CloudWatch) send(batch []types.InputLogEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	// Concurrent writers can enqueue slightly out of order, and CloudWatch
+	// rejects batches that are not in chronological order.
+	sort.SliceStable(batch, func(i, j int) bool {
+		return *batch[i].Timestamp < *batch[j].Timestamp
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := cw.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(cw.group),
+		LogStreamName: aws.String(cw.stream),
+		LogEvents:     batch,
+	})
+	cw.lastErr.Store(sendError{err: err})
+	if err == nil {
+		return
+	}
+
+	cw.failed.Add(int64(len(batch)))
+
+	if cw.opts.Fallback == nil {
+		return
+	}
+
+	cw.fallback.Lock()
+	defer cw.fallback.Unlock()
+
+	fmt.Fprintf(cw.opts.Fallback, "PutLogEvents error, writing %d events locally: %v\n", len(batch), err)
+	for _, event := range batch {
+		fmt.Fprintln(cw.opts.Fallback, *event.Message)
+	}
+}
@@ -0,0 +1,25 @@
+package logsink
+
+import (
+	"io"
+)
+
+type multiWriter []io.Writer
+
+// Multi returns a writer that duplicates each write to every sink. Unlike
+// io.MultiWriter, a failing sink does not stop the write from reaching the
+// sinks after it; the first error is returned once all have been tried.
+func Multi(writers ...io.Writer) io.Writer {
+	return multiWriter(writers)
+}
+
+func (mw multiWriter) Write(p []byte) (int, error) {
+	var firstErr error
+	for _, w := range mw {
+		_, err := w.Write(p)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return len(p), firstErr
+}
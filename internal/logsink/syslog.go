@@ -0,0 +1,52 @@
+//go:build !windows && !plan9
+
+package logsink
+
+import (
+	"bytes"
+	"log/syslog"
+)
+
+// Syslog is an io.WriteCloser that forwards jsonlog lines to a syslog
+// daemon, using each line's level to pick the syslog severity.
+type Syslog struct {
+	writer *syslog.Writer
+}
+
+// NewSyslog connects to the syslog daemon at addr over network. An empty
+// network and addr connect to the local daemon.
+func NewSyslog(network, addr, tag string) (*Syslog, error) {
+	writer, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Syslog{writer: writer}, nil
+}
+
+func (s *Syslog) Write(p []byte) (int, error) {
+	message := string(bytes.TrimSuffix(p, []byte("\n")))
+
+	var err error
+	switch {
+	case bytes.HasPrefix(p, []byte(`{"level":"DEBUG"`)):
+		err = s.writer.Debug(message)
+	case bytes.HasPrefix(p, []byte(`{"level":"WARN"`)):
+		err = s.writer.Warning(message)
+	case bytes.HasPrefix(p, []byte(`{"level":"ERROR"`)):
+		err = s.writer.Err(message)
+	case bytes.HasPrefix(p, []byte(`{"level":"FATAL"`)):
+		err = s.writer.Crit(message)
+	default:
+		err = s.writer.Info(message)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (s *Syslog) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,21 @@
+//go:build windows || plan9
+
+package logsink
+
+import (
+	"errors"
+)
+
+type Syslog struct{}
+
+func NewSyslog(network, addr, tag string) (*Syslog, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (s *Syslog) Write(p []byte) (int, error) {
+	return 0, errors.New("syslog is not supported on this platform")
+}
+
+func (s *Syslog) Close() error {
+	return nil
+}